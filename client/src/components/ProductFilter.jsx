@@ -1,7 +1,35 @@
 import React from 'react';
 import { Filter, Tag } from 'lucide-react';
 
+// categories is the tree from /api/shop/categories, filtered by slug. The subcategories of the selected
+// top-level category are offered in a second row.
 const ProductFilter = ({ categories, selectedCategory, onCategoryChange, productCounts = {} }) => {
+  const contains = (category) =>
+    category.slug === selectedCategory || (category.children || []).some(contains);
+  const branch = categories.find(contains);
+
+  const categoryButton = (category) => (
+    <button
+      key={category.slug}
+      onClick={() => onCategoryChange(category.slug)}
+      className={`px-3 py-1 text-sm rounded-full transition-colors flex items-center ${
+        selectedCategory === category.slug
+          ? 'bg-rose-500 text-white'
+          : 'bg-gray-100 text-gray-700 hover:bg-gray-200'
+      }`}
+    >
+      <Tag className="h-3.5 w-3.5 mr-1" />
+      {category.name}
+      <span className={`ml-1 px-1.5 py-0.5 text-xs rounded-full ${
+        selectedCategory === category.slug
+          ? 'bg-rose-300 text-rose-800'
+          : 'bg-gray-200 text-gray-800'
+      }`}>
+        {category.product_count}
+      </span>
+    </button>
+  );
+
   return (
     <div className="flex flex-col w-full mb-6">
       <div className="flex items-center mb-3">
@@ -20,33 +48,21 @@ const ProductFilter = ({ categories, selectedCategory, onCategoryChange, product
         >
           <Tag className="h-3.5 w-3.5 mr-1" />
           All Products
-          <span className="ml-1 px-1.5 py-0.5 text-xs rounded-full bg-gray-200 text-gray-800">
-            {productCounts.all || 0}
-          </span>
+          {productCounts.all !== undefined && (
+            <span className="ml-1 px-1.5 py-0.5 text-xs rounded-full bg-gray-200 text-gray-800">
+              {productCounts.all}
+            </span>
+          )}
         </button>
         
-        {categories.map((category) => (
-          <button
-            key={category}
-            onClick={() => onCategoryChange(category)}
-            className={`px-3 py-1 text-sm rounded-full transition-colors flex items-center ${
-              selectedCategory === category
-                ? 'bg-rose-500 text-white'
-                : 'bg-gray-100 text-gray-700 hover:bg-gray-200'
-            }`}
-          >
-            <Tag className="h-3.5 w-3.5 mr-1" />
-            {category}
-            <span className={`ml-1 px-1.5 py-0.5 text-xs rounded-full ${
-              selectedCategory === category
-                ? 'bg-rose-300 text-rose-800'
-                : 'bg-gray-200 text-gray-800'
-            }`}>
-              {productCounts[category] || 0}
-            </span>
-          </button>
-        ))}
+        {categories.map(categoryButton)}
       </div>
+
+      {branch?.children?.length > 0 && (
+        <div className="flex flex-wrap gap-2 mt-2 pl-4 border-l-2 border-rose-100">
+          {branch.children.map(categoryButton)}
+        </div>
+      )}
     </div>
   );
 };
@@ -69,7 +69,7 @@ function Signup() {
       // Check if the request was successful
       if (response.ok) {
         // Store user data in localStorage
-        localStorage.setItem('token', 'dummy-token'); // We'll implement proper tokens later
+        localStorage.setItem('token', data.token);
         localStorage.setItem('userId', data.id);
         localStorage.setItem('username', data.name);
         localStorage.setItem('role', data.role);
@@ -86,8 +86,9 @@ function Signup() {
           navigate('/');
         }
       } else {
-        // Server returned an error
-        setSignupError(data.error || 'Signup failed. Please try again.');
+        // Server returned an error; validation errors list each invalid field
+        const details = data.error?.details?.map(d => `${d.field.replace('_', ' ')} ${d.message}`);
+        setSignupError(details?.length ? details.join(', ') : (data.error?.message || 'Signup failed. Please try again.'));
       }
     } catch (error) {
       console.error('Signup error:', error);
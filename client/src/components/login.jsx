@@ -74,7 +74,7 @@ function Login() {
           navigate('/');
         }
       } else {
-        setLoginError(data.error || 'Invalid email or password');
+        setLoginError(data.error?.message || 'Invalid email or password');
       }
     } catch (error) {
       console.error('Login error:', error);
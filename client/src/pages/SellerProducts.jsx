@@ -14,14 +14,35 @@ const SellerProducts = () => {
     imageUrl: ''
   });
   const [editingProduct, setEditingProduct] = useState(null);
+  const [categoryOptions, setCategoryOptions] = useState([]);
 
   // Get seller ID from localStorage (assuming it was stored during login)
   const sellerId = localStorage.getItem('userId');
 
   useEffect(() => {
     loadProducts();
+    loadCategories();
   }, []);
 
+  // Flatten the category tree into select options, indenting subcategories under their parents
+  const loadCategories = async () => {
+    try {
+      const response = await fetch('http://localhost:8081/api/shop/categories');
+      const data = await response.json();
+      const options = [];
+      const walk = (categories, depth) => {
+        for (const category of categories) {
+          options.push({ id: category.id, label: `${'\u00A0\u00A0'.repeat(depth)}${category.name}` });
+          walk(category.children || [], depth + 1);
+        }
+      };
+      walk(data.categories || [], 0);
+      setCategoryOptions(options);
+    } catch (err) {
+      console.error('Error fetching categories:', err);
+    }
+  };
+
   const loadProducts = async () => {
     try {
       setLoading(true);
@@ -47,11 +68,14 @@ const SellerProducts = () => {
   const handleSubmit = async (e) => {
     e.preventDefault();
     try {
+      // The form keeps the selected category id in the category field
+      const { category, ...fields } = formData;
       const productData = {
-        ...formData,
+        ...fields,
         seller_id: parseInt(sellerId),
         price: parseFloat(formData.price),
-        stock: parseInt(formData.stock)
+        stock: parseInt(formData.stock),
+        category_id: parseInt(category)
       };
 
       if (editingProduct) {
@@ -90,7 +114,7 @@ const SellerProducts = () => {
       description: product.description || '',
       price: product.price.toString(),
       stock: product.stock.toString(),
-      category: product.category || '',
+      category: product.category_id ? product.category_id.toString() : '',
       imageUrl: product.image_url || ''
     });
   };
@@ -179,14 +203,9 @@ const SellerProducts = () => {
                   className="w-full p-3 border border-gray-300 rounded-md focus:ring-blue-500 focus:border-blue-500 bg-white"
                 >
                   <option value="" disabled>Select a category</option>
-                  <option value="Electronics">Electronics</option>
-                  <option value="Clothing">Clothing</option>
-                  <option value="Beauty & Personal Care">Beauty & Personal Care</option>
-                  <option value="Home & Kitchen">Home & Kitchen</option>
-                  <option value="Books">Books</option>
-                  <option value="Toys & Games">Toys & Games</option>
-                  <option value="Sports & Outdoors">Sports & Outdoors</option>
-                  <option value="Food & Beverages">Food & Beverages</option>
+                  {categoryOptions.map((option) => (
+                    <option key={option.id} value={option.id}>{option.label}</option>
+                  ))}
                 </select>
               </div>
               <div>
@@ -5,100 +5,75 @@ import ProductFilter from '../components/ProductFilter';
 const Shop = () => {
   console.log('Shop component rendered');
   const [products, setProducts] = useState([]);
-  const [allProducts, setAllProducts] = useState([]);
   const [categories, setCategories] = useState([]);
   const [productCounts, setProductCounts] = useState({});
   const [selectedCategory, setSelectedCategory] = useState('all');
+  const [nextCursor, setNextCursor] = useState(null);
   const [loading, setLoading] = useState(true);
+  const [loadingMore, setLoadingMore] = useState(false);
   const [error, setError] = useState('');
   
   const userId = localStorage.getItem('userId');
 
 
-  // Extract unique categories and count products per category
-  const extractCategoriesAndCounts = (products) => {
-    // Predefined list of categories to ensure they're always available
-    const predefinedCategories = [
-      'Electronics',
-      'Clothing',
-      'Books',
-      'Home & Living',
-      'Sports & Outdoors',
-      'Beauty & Personal Care',
-      'Others'
-    ];
-    
-    const categoriesMap = {};
-    const counts = { all: products.length };
-    
-    // Initialize predefined categories
-    predefinedCategories.forEach(category => {
-      categoriesMap[category] = false; // false means it's predefined but not in products yet
-      counts[category] = 0;
-    });
-    
-    // Process actual products
-    products.forEach(product => {
-      if (product.category && product.category.trim() !== '') {
-        // Mark this category as existing in products
-        categoriesMap[product.category] = true;
-        
-        // Count products per category
-        counts[product.category] = (counts[product.category] || 0) + 1;
-      }
-    });
-    
-    // Get all categories (both predefined and from products)
-    const allCategories = Object.keys(categoriesMap).sort();
-    
-    return {
-      categories: allCategories,
-      productCounts: counts
-    };
+  // The category tree; the catalog is filtered by category slug
+  const fetchCategories = async () => {
+    try {
+      const response = await fetch('http://localhost:8081/api/shop/categories', {
+        headers: { 'Accept': 'application/json' }
+      });
+      const data = await response.json();
+      setCategories(data.categories || []);
+    } catch (err) {
+      console.error('Error fetching categories:', err);
+    }
   };
 
-  const fetchProducts = async () => {
+  // Find a category anywhere in the tree by slug
+  const findCategory = (list, slug) => {
+    for (const category of list) {
+      if (category.slug === slug) return category;
+      const found = findCategory(category.children || [], slug);
+      if (found) return found;
+    }
+    return null;
+  };
+
+  // Fetch one page of products; without a cursor the listing starts over
+  const fetchProducts = async (category, cursor = null) => {
     try {
-      setLoading(true);
+      if (cursor) {
+        setLoadingMore(true);
+      } else {
+        setLoading(true);
+      }
       setError('');
-      console.log('Fetching all products...');
 
-      const response = await fetch('http://localhost:8081/api/shop/products', {
+      const params = new URLSearchParams();
+      if (category !== 'all') params.set('category', category);
+      if (cursor) params.set('cursor', cursor);
+
+      const response = await fetch(`http://localhost:8081/api/shop/products?${params}`, {
         headers: {
           'Accept': 'application/json',
         }
       });
-      
-      if (!response.ok) {
-        const errorText = await response.text();
-        console.error('Server response:', errorText);
-        throw new Error(errorText || 'Failed to fetch products');
-      }
 
       const data = await response.json();
-      console.log('Received response:', data);
-      if (data.success) {
-        setAllProducts(data.products);
-        // Extract categories and counts from products
-        const { categories: extractedCategories, productCounts } = extractCategoriesAndCounts(data.products);
-        setCategories(extractedCategories);
-        setProductCounts(productCounts);
-        
-        // Apply initial filtering
-        if (selectedCategory === 'all') {
-          setProducts(data.products);
-        } else {
-          const filtered = data.products.filter(product => product.category === selectedCategory);
-          setProducts(filtered);
-        }
-      } else {
-        throw new Error('Failed to fetch products');
+      if (!response.ok || !data.success) {
+        throw new Error(data.error?.message || 'Failed to fetch products');
       }
+
+      setProducts(prev => (cursor ? [...prev, ...data.products] : data.products));
+      setNextCursor(data.next_cursor);
+      // The total covers every page, so it is the count for the selected category
+      setProductCounts({ [category]: data.total });
     } catch (err) {
       setError(err.message);
       console.error('Error details:', err);
     } finally {
       setLoading(false);
+      setLoadingMore(false);
     }
   };
 
@@ -109,22 +84,14 @@ const Shop = () => {
   };
 
   useEffect(() => {
-    console.log('Shop useEffect triggered');
-    fetchProducts();
+    fetchCategories();
   }, []);
-  
-  // Effect to filter products when category changes
+
+  // Start the listing over whenever the category changes
   useEffect(() => {
-    if (!allProducts.length) return;
-    
-    if (selectedCategory === 'all') {
-      setProducts(allProducts);
-    } else {
-      const filtered = allProducts.filter(product => product.category === selectedCategory);
-      setProducts(filtered);
-    }
-  }, [selectedCategory, allProducts]);
-  
+    fetchProducts(selectedCategory);
+  }, [selectedCategory]);
+
   const handleCategoryChange = (category) => {
     console.log(`Changing category to: ${category}`);
     setSelectedCategory(category);
@@ -197,7 +164,7 @@ const Shop = () => {
         {products.length === 0 ? (
           <div className="flex flex-col justify-center items-center h-64 text-gray-500">
             <ShoppingCart className="h-12 w-12 mb-4" />
-            <p className="text-lg">{selectedCategory === 'all' ? 'No products available' : `No products found in category "${selectedCategory}"`}</p>
+            <p className="text-lg">{selectedCategory === 'all' ? 'No products available' : `No products found in category "${findCategory(categories, selectedCategory)?.name || selectedCategory}"`}</p>
             {selectedCategory !== 'all' && (
               <button 
                 onClick={() => handleCategoryChange('all')} 
@@ -241,6 +208,18 @@ const Shop = () => {
             ))}
           </div>
         )}
+
+        {nextCursor && (
+          <div className="mt-8 flex justify-center">
+            <button
+              onClick={() => fetchProducts(selectedCategory, nextCursor)}
+              disabled={loadingMore}
+              className="px-6 py-2 bg-rose-500 text-white rounded-md hover:bg-rose-600 transition-colors disabled:opacity-50"
+            >
+              {loadingMore ? 'Loading...' : 'Load more'}
+            </button>
+          </div>
+        )}
       </div>
     </div>
   );
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/rythmokay/golang/server/database"
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/store/postgres"
+)
+
+const adminUsage = `usage: server admin <command>
+
+commands:
+  grant <email>   make an existing user an administrator; they must sign in again to use the role`
+
+// runAdminCommand implements the "admin" subcommand and returns the process exit code.
+// Administrators manage the category tree; signup never creates them.
+func runAdminCommand(args []string) int {
+	if len(args) != 2 || args[0] != "grant" {
+		fmt.Fprintln(os.Stderr, adminUsage)
+		return 2
+	}
+	email := args[1]
+	ctx := context.Background()
+	users := postgres.NewStores(database.DB).Users
+
+	user, err := users.GetUserByEmail(ctx, email)
+	if err == nil {
+		err = users.SetRole(ctx, user.ID, models.RoleAdmin)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		slog.Error("no active user has that email", "email", email)
+		return 1
+	}
+	if err != nil {
+		slog.Error("could not grant administrator role", "err", err)
+		return 1
+	}
+	slog.Info("user is now an administrator", "email", email)
+	return 0
+}
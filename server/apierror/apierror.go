@@ -0,0 +1,258 @@
+// Package apierror defines the JSON error envelope returned by every API endpoint:
+//
+//	{"error": {"code": "not_found", "message": "Order not found", "details": [...], "request_id": "..."}}
+//
+// Handlers build an *Error with one of the constructors and send it with Write, which also turns
+// store, Postgres and context errors into the matching response.
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/rythmokay/golang/server/logging"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/validate"
+)
+
+// Error codes. Clients should branch on the code, not the message.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeConflict           = "conflict"
+	CodeValidation         = "validation_failed"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal_error"
+	CodeServiceUnavailable = "service_unavailable"
+)
+
+// FieldError describes what is wrong with one request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an API error response
+type Error struct {
+	Status    int          `json:"-"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	// cause is logged for server errors but never sent to the client
+	cause error
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.cause)
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// WithMessage returns a copy of e with a different message
+func (e *Error) WithMessage(message string) *Error {
+	c := *e
+	c.Message = message
+	return &c
+}
+
+// New returns an error response with the given status, code and message
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest is returned for malformed requests
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// Unauthorized is returned when authentication is missing or invalid
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// Forbidden is returned when the authenticated user may not perform the request
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+// NotFound is returned when the requested record does not exist
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+// MethodNotAllowed is returned when the route does not support the request method
+func MethodNotAllowed() *Error {
+	return New(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+}
+
+// Conflict is returned when the request clashes with the current state, such as a duplicate email
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// Validation is returned when the request is well-formed but its values are not acceptable
+func Validation(message string, details ...FieldError) *Error {
+	e := New(http.StatusUnprocessableEntity, CodeValidation, message)
+	e.Details = details
+	return e
+}
+
+// TooManyRequests is returned when a rate limit or lockout applies
+func TooManyRequests(message string) *Error {
+	return New(http.StatusTooManyRequests, CodeRateLimited, message)
+}
+
+// Internal is returned when the server failed; cause is logged, not sent
+func Internal(message string, cause error) *Error {
+	e := New(http.StatusInternalServerError, CodeInternal, message)
+	e.cause = cause
+	return e
+}
+
+// Unavailable is returned when a dependency is down or too slow
+func Unavailable(message string, cause error) *Error {
+	e := New(http.StatusServiceUnavailable, CodeServiceUnavailable, message)
+	e.cause = cause
+	return e
+}
+
+// From converts any error into an API error:
+//   - an *Error anywhere in the chain is used as is
+//   - a validation error becomes 422 listing every invalid field
+//   - Postgres unique violations become 409 and check, not-null and foreign key violations 422,
+//     with the offending column in the details
+//   - store errors become 404, 409 or 422
+//   - a query deadline becomes 503, whether it surfaces as the context error or as the query Postgres cancelled
+//   - anything else is an internal error
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var valErr *validate.Error
+	if errors.As(err, &valErr) {
+		details := make([]FieldError, len(valErr.Fields))
+		for i, f := range valErr.Fields {
+			details[i] = FieldError{Field: f.Field, Message: f.Message}
+		}
+		return Validation("Request validation failed", details...)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if e := fromPostgres(pqErr); e != nil {
+			return e
+		}
+	}
+
+	var stockErr *store.InsufficientStockError
+	switch {
+	case errors.As(err, &stockErr):
+		return Conflict(stockErr.Error())
+	case errors.Is(err, store.ErrNotFound):
+		return NotFound("Not found")
+	case errors.Is(err, store.ErrEmailTaken):
+		return Conflict("Email already registered")
+	case errors.Is(err, store.ErrInvalid):
+		return Validation("Request contains invalid values")
+	case errors.Is(err, store.ErrEmptyCart):
+		return Validation("Cart is empty")
+	case errors.Is(err, store.ErrProductInUse), errors.Is(err, store.ErrCategoryInUse):
+		return Conflict("The record is still in use")
+	case errors.Is(err, context.DeadlineExceeded):
+		return Unavailable("The request took too long, please try again", err)
+	}
+	return Internal("Internal server error", err)
+}
+
+// fromPostgres maps constraint violations (SQLSTATE class 23) to client errors, and queries cancelled
+// because their context ended (57014) to 503 like the context error itself
+func fromPostgres(err *pq.Error) *Error {
+	field := constraintField(err)
+	var details []FieldError
+
+	switch err.Code.Name() {
+	case "query_canceled":
+		return Unavailable("The request took too long, please try again", err)
+	case "unique_violation":
+		e := Conflict("A record with this value already exists")
+		if field != "" {
+			e.Details = []FieldError{{Field: field, Message: "is already taken"}}
+		}
+		return e
+	case "check_violation":
+		if field != "" {
+			details = []FieldError{{Field: field, Message: "is not an allowed value"}}
+		}
+		return Validation("Request contains invalid values", details...)
+	case "not_null_violation":
+		if field != "" {
+			details = []FieldError{{Field: field, Message: "is required"}}
+		}
+		return Validation("A required value is missing", details...)
+	case "foreign_key_violation":
+		// Deleting a referenced row conflicts with existing data; inserting a dangling reference is invalid input
+		if strings.Contains(err.Detail, "is still referenced") {
+			return Conflict("The record is still in use")
+		}
+		if field != "" {
+			details = []FieldError{{Field: field, Message: "refers to a record that does not exist"}}
+		}
+		return Validation("Request refers to a record that does not exist", details...)
+	}
+	return nil
+}
+
+// constraintField recovers the column a violated constraint is about, relying on Postgres' default
+// constraint names such as products_price_check, users_email_key or order_items_product_id_fkey
+func constraintField(err *pq.Error) string {
+	if err.Column != "" {
+		return err.Column
+	}
+	name := err.Constraint
+	if name == "" {
+		return ""
+	}
+	name = strings.TrimPrefix(name, "idx_")
+	name = strings.TrimPrefix(name, err.Table+"_")
+	for _, suffix := range []string{"_check", "_key", "_fkey"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return name
+}
+
+// Write sends err as a JSON error envelope tagged with the request ID.
+// Server errors that carry a cause are logged with it.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	e := From(err)
+	resp := *e
+	resp.RequestID = logging.RequestID(r.Context())
+
+	if resp.Status >= http.StatusInternalServerError && resp.cause != nil {
+		slog.ErrorContext(r.Context(), "request failed", "code", resp.Code, "err", resp.cause)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(resp.Status)
+	json.NewEncoder(w).Encode(struct {
+		Error *Error `json:"error"`
+	}{&resp})
+}
@@ -0,0 +1,28 @@
+package apierror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestFromQueryDeadline(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"context deadline", fmt.Errorf("listing products: %w", context.DeadlineExceeded)},
+		{"query cancelled by Postgres", fmt.Errorf("listing products: %w", &pq.Error{Code: "57014", Message: "canceling statement due to user request"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := From(tt.err)
+			if got.Status != http.StatusServiceUnavailable || got.Code != CodeServiceUnavailable {
+				t.Errorf("From() = %d %s, want %d %s", got.Status, got.Code, http.StatusServiceUnavailable, CodeServiceUnavailable)
+			}
+		})
+	}
+}
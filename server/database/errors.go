@@ -0,0 +1,25 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// IsUniqueViolation reports whether err is a Postgres unique constraint violation
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// IsCheckViolation reports whether err is a Postgres check constraint violation
+func IsCheckViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23514"
+}
+
+// IsForeignKeyViolation reports whether err is a Postgres foreign key violation
+func IsForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -0,0 +1,20 @@
+-- One row per account email or client IP with consecutive failed logins
+CREATE TABLE IF NOT EXISTS login_throttles (
+    scope VARCHAR(10) NOT NULL CHECK (scope IN ('account', 'ip')),
+    key VARCHAR(255) NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE TABLE IF NOT EXISTS auth_audit_log (
+    id SERIAL PRIMARY KEY,
+    event VARCHAR(50) NOT NULL,
+    email VARCHAR(100),
+    ip_address VARCHAR(45),
+    details JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_audit_log_event ON auth_audit_log(event, created_at);
@@ -0,0 +1,3 @@
+-- 0008 only repairs databases created from the legacy schema files.
+-- The schema it leaves behind is the one 0001 creates, so there is nothing to revert.
+SELECT 1;
@@ -0,0 +1,77 @@
+-- Databases created from the old schema.sql / schema_update.sql files were adopted as-is by 0001.
+-- This brings them in line with the schema 0001 creates; on databases built by the migrations it changes nothing.
+
+-- database/schema.sql stored the unit price as price_at_time
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'order_items' AND column_name = 'price_at_time'
+    ) THEN
+        ALTER TABLE order_items RENAME COLUMN price_at_time TO price;
+    END IF;
+END $$;
+
+-- schema_update.sql added order_items.seller_id, which checkout never wrote; the seller comes from products
+ALTER TABLE order_items DROP COLUMN IF EXISTS seller_id;
+
+-- database/schema.sql had no payment or contact columns
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_method VARCHAR(50) NOT NULL DEFAULT 'cod' CHECK (payment_method IN ('razorpay', 'cod'));
+ALTER TABLE orders ALTER COLUMN payment_method DROP DEFAULT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payment_id VARCHAR(100);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS contact_number VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE orders ALTER COLUMN contact_number DROP DEFAULT;
+
+-- Timestamps were stored without a time zone
+ALTER TABLE users ALTER COLUMN created_at TYPE TIMESTAMP WITH TIME ZONE;
+ALTER TABLE products ALTER COLUMN created_at TYPE TIMESTAMP WITH TIME ZONE;
+ALTER TABLE products ALTER COLUMN updated_at TYPE TIMESTAMP WITH TIME ZONE;
+ALTER TABLE cart_items ALTER COLUMN created_at TYPE TIMESTAMP WITH TIME ZONE;
+ALTER TABLE orders ALTER COLUMN created_at TYPE TIMESTAMP WITH TIME ZONE;
+ALTER TABLE orders ALTER COLUMN updated_at TYPE TIMESTAMP WITH TIME ZONE;
+ALTER TABLE order_items ALTER COLUMN created_at TYPE TIMESTAMP WITH TIME ZONE;
+
+-- Ownership columns were nullable
+DELETE FROM cart_items WHERE user_id IS NULL OR product_id IS NULL;
+UPDATE products SET category = 'Other' WHERE category IS NULL;
+ALTER TABLE products ALTER COLUMN seller_id SET NOT NULL;
+ALTER TABLE products ALTER COLUMN category SET NOT NULL;
+ALTER TABLE cart_items ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE cart_items ALTER COLUMN product_id SET NOT NULL;
+ALTER TABLE orders ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE order_items ALTER COLUMN order_id SET NOT NULL;
+ALTER TABLE order_items ALTER COLUMN product_id SET NOT NULL;
+
+-- Check constraints that only the newer schema had; dropped first so this is safe to run on any database
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_name_check;
+ALTER TABLE users ADD CONSTRAINT users_name_check CHECK (length(trim(name)) > 0);
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_check;
+ALTER TABLE users ADD CONSTRAINT users_email_check CHECK (email ~* '^[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}$');
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_password_check;
+ALTER TABLE users ADD CONSTRAINT users_password_check CHECK (length(password) >= 6);
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_name_check;
+ALTER TABLE products ADD CONSTRAINT products_name_check CHECK (length(trim(name)) > 0);
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_price_check;
+ALTER TABLE products ADD CONSTRAINT products_price_check CHECK (price > 0);
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_stock_check;
+ALTER TABLE products ADD CONSTRAINT products_stock_check CHECK (stock >= 0);
+
+ALTER TABLE cart_items DROP CONSTRAINT IF EXISTS cart_items_quantity_check;
+ALTER TABLE cart_items ADD CONSTRAINT cart_items_quantity_check CHECK (quantity > 0);
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_total_amount_check;
+ALTER TABLE orders ADD CONSTRAINT orders_total_amount_check CHECK (total_amount > 0);
+-- database/schema.sql did not allow the 'paid' status
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (status IN ('pending', 'paid', 'processing', 'shipped', 'delivered', 'cancelled'));
+
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_quantity_check;
+ALTER TABLE order_items ADD CONSTRAINT order_items_quantity_check CHECK (quantity > 0);
+ALTER TABLE order_items DROP CONSTRAINT IF EXISTS order_items_price_check;
+ALTER TABLE order_items ADD CONSTRAINT order_items_price_check CHECK (price > 0);
+
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_products_seller ON products(seller_id);
+CREATE INDEX IF NOT EXISTS idx_cart_user ON cart_items(user_id);
+CREATE INDEX IF NOT EXISTS idx_cart_product ON cart_items(product_id);
@@ -0,0 +1,12 @@
+CREATE INDEX IF NOT EXISTS idx_products_seller ON products(seller_id);
+
+DROP INDEX IF EXISTS idx_products_seller_created_at_id;
+DROP INDEX IF EXISTS idx_products_category_price_id;
+DROP INDEX IF EXISTS idx_products_category_created_at_id;
+DROP INDEX IF EXISTS idx_products_units_sold_id;
+DROP INDEX IF EXISTS idx_products_name_id;
+DROP INDEX IF EXISTS idx_products_price_id;
+DROP INDEX IF EXISTS idx_products_created_at_id;
+
+ALTER TABLE products ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE products DROP COLUMN units_sold;
@@ -0,0 +1,25 @@
+-- Units ordered per product, kept up to date by checkout, for the "popular" catalog sort
+ALTER TABLE products ADD COLUMN units_sold INTEGER NOT NULL DEFAULT 0 CHECK (units_sold >= 0);
+UPDATE products p
+SET units_sold = sold.quantity
+FROM (SELECT product_id, SUM(quantity) AS quantity FROM order_items GROUP BY product_id) sold
+WHERE sold.product_id = p.id;
+
+-- Keyset pagination compares (sort key, id) with the last row of the previous page, so created_at cannot be NULL
+UPDATE products SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+ALTER TABLE products ALTER COLUMN created_at SET NOT NULL;
+
+-- One index per sort order, each ending in id so the cursor comparison is an index range scan.
+-- Descending sorts scan the same indexes backwards.
+CREATE INDEX IF NOT EXISTS idx_products_created_at_id ON products(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_products_price_id ON products(price, id);
+CREATE INDEX IF NOT EXISTS idx_products_name_id ON products(name, id);
+CREATE INDEX IF NOT EXISTS idx_products_units_sold_id ON products(units_sold, id);
+
+-- Browsing a category or a seller's shop is the common filtered listing
+CREATE INDEX IF NOT EXISTS idx_products_category_created_at_id ON products(category, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_products_category_price_id ON products(category, price, id);
+CREATE INDEX IF NOT EXISTS idx_products_seller_created_at_id ON products(seller_id, created_at, id);
+
+-- Covered by idx_products_seller_created_at_id
+DROP INDEX IF EXISTS idx_products_seller;
@@ -0,0 +1,12 @@
+-- Trigram matching for misspelled searches. pg_trgm is a trusted extension, so the database owner can create it.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Full-text document for each product: matches in the name rank above the category, which ranks above the description
+ALTER TABLE products ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(category, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops);
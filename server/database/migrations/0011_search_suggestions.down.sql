@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS search_misses;
+DROP INDEX IF EXISTS idx_users_seller_name_trgm;
+DROP INDEX IF EXISTS idx_products_category_trgm;
@@ -0,0 +1,15 @@
+-- Suggestions match names containing the typed text; trigram indexes answer ILIKE '%text%' without a full scan.
+-- products.name is already covered by idx_products_name_trgm.
+CREATE INDEX IF NOT EXISTS idx_products_category_trgm ON products USING GIN (category gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_seller_name_trgm ON users USING GIN (name gin_trgm_ops)
+    WHERE role = 'seller' AND deleted_at IS NULL;
+
+-- Searches that found nothing, counted per normalized query and day, so sellers can see unmet demand
+CREATE TABLE IF NOT EXISTS search_misses (
+    query VARCHAR(200) NOT NULL CHECK (length(query) > 0),
+    day DATE NOT NULL DEFAULT CURRENT_DATE,
+    searches INTEGER NOT NULL DEFAULT 1 CHECK (searches > 0),
+    PRIMARY KEY (query, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_misses_day ON search_misses(day);
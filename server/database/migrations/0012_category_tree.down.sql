@@ -0,0 +1,15 @@
+-- Administrators cannot exist without the role; they become customers
+UPDATE users SET role = 'customer' WHERE role = 'admin';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('seller', 'customer'));
+
+CREATE INDEX IF NOT EXISTS idx_products_category_trgm ON products USING GIN (category gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_products_category_created_at_id ON products(category, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_products_category_price_id ON products(category, price, id);
+DROP INDEX IF EXISTS idx_products_category_id_price_id;
+DROP INDEX IF EXISTS idx_products_category_id_created_at_id;
+
+-- products.category keeps the normalized names
+ALTER TABLE products DROP COLUMN category_id;
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,75 @@
+-- Categories form a tree managed by administrators. The slug identifies a category in URLs and catalog
+-- filters; position orders siblings.
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    parent_id INTEGER REFERENCES categories(id),
+    name VARCHAR(100) NOT NULL CHECK (length(trim(name)) > 0),
+    slug VARCHAR(100) NOT NULL UNIQUE CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$'),
+    position INTEGER NOT NULL DEFAULT 0 CHECK (position >= 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (parent_id <> id)
+);
+
+-- Siblings must differ by more than case; top-level categories are all siblings of parent 0
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_sibling_name ON categories (COALESCE(parent_id, 0), lower(name));
+CREATE INDEX IF NOT EXISTS idx_categories_parent_position ON categories (parent_id, position);
+
+-- The categories the seller product form has always offered
+INSERT INTO categories (name, slug) VALUES
+    ('Electronics', 'electronics'),
+    ('Clothing', 'clothing'),
+    ('Beauty & Personal Care', 'beauty-personal-care'),
+    ('Home & Kitchen', 'home-kitchen'),
+    ('Books', 'books'),
+    ('Toys & Games', 'toys-games'),
+    ('Sports & Outdoors', 'sports-outdoors'),
+    ('Food & Beverages', 'food-beverages')
+ON CONFLICT (slug) DO NOTHING;
+
+-- Normalize the free-text categories: each spelling gets the slug models.Slugify computes, so "Electronics",
+-- "electronics " and "ELECTRONICS" share one. Blank values become "Uncategorized", and names with no ASCII
+-- letters or digits get a slug derived from a hash of the name.
+CREATE TEMPORARY TABLE category_spellings AS
+SELECT category AS spelling,
+       trim(regexp_replace(category, '\s+', ' ', 'g')) AS name,
+       trim(BOTH '-' FROM regexp_replace(lower(category), '[^a-z0-9]+', '-', 'g')) AS slug,
+       COUNT(*) AS products
+FROM products
+GROUP BY category;
+
+UPDATE category_spellings SET name = 'Uncategorized', slug = 'uncategorized' WHERE name = '';
+UPDATE category_spellings SET slug = 'category-' || left(md5(lower(name)), 8) WHERE slug = '';
+
+-- One top-level category per slug, named after its most used spelling
+INSERT INTO categories (name, slug)
+SELECT DISTINCT ON (slug) name, slug
+FROM category_spellings
+ORDER BY slug, products DESC, name
+ON CONFLICT (slug) DO NOTHING;
+
+-- Products reference their category. products.category stays as a copy of the category name because the
+-- search vector is generated from it; the stores rewrite it whenever a product moves or a category is renamed.
+ALTER TABLE products ADD COLUMN category_id INTEGER REFERENCES categories(id);
+UPDATE products p
+SET category_id = c.id, category = c.name
+FROM category_spellings s
+JOIN categories c ON c.slug = s.slug
+WHERE s.spelling = p.category;
+ALTER TABLE products ALTER COLUMN category_id SET NOT NULL;
+
+DROP TABLE category_spellings;
+
+-- Catalog filters now match category ids, so the category listing indexes key on them instead
+DROP INDEX IF EXISTS idx_products_category_created_at_id;
+DROP INDEX IF EXISTS idx_products_category_price_id;
+CREATE INDEX IF NOT EXISTS idx_products_category_id_created_at_id ON products(category_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_products_category_id_price_id ON products(category_id, price, id);
+
+-- Category suggestions search the categories table now
+DROP INDEX IF EXISTS idx_products_category_trgm;
+
+-- Administrators manage the tree. They are promoted with "server admin grant"; signup still only creates
+-- sellers and customers.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('seller', 'customer', 'admin'));
@@ -0,0 +1,8 @@
+-- Products of deleted sellers stay for order history but are hidden from the storefront
+ALTER TABLE products ADD COLUMN IF NOT EXISTS unlisted_at TIMESTAMP WITH TIME ZONE;
+
+-- Sellers deleted before this migration only had their stock zeroed
+UPDATE products p
+SET unlisted_at = u.deleted_at
+FROM users u
+WHERE u.id = p.seller_id AND u.deleted_at IS NOT NULL AND p.unlisted_at IS NULL;
@@ -1,3 +1,328 @@
 package database
 
-// This file is intentionally left empty as the RunMigrations function has been moved to db.go
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the Postgres advisory lock held while migrations run,
+// so two server instances starting together cannot migrate at the same time
+const migrationLockKey int64 = 7_351_204_118
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change with its up and down SQL
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus describes whether a migration has been applied to the database
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// ChecksumMismatch is true when the applied migration was edited after it ran
+	ChecksumMismatch bool
+}
+
+// LoadMigrations reads the embedded migration files in version order
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		contents, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has mismatched names %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(contents)
+			sum := sha256.Sum256(contents)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// withMigrationLock runs fn on a single connection while holding the migration advisory lock
+func withMigrationLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	return fn(ctx, conn)
+}
+
+// migrationStatuses compares the embedded migrations with the rows in schema_migrations
+func migrationStatuses(ctx context.Context, conn *sql.Conn) ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type appliedRow struct {
+		checksum  string
+		appliedAt time.Time
+	}
+	applied := map[int]appliedRow{}
+	for rows.Next() {
+		var version int
+		var row appliedRow
+		if err := rows.Scan(&version, &row.checksum, &row.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = row
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	known := map[int]bool{}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+		status := MigrationStatus{Migration: m}
+		if row, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = row.appliedAt
+			status.ChecksumMismatch = row.checksum != m.Checksum
+		}
+		statuses = append(statuses, status)
+	}
+
+	for version := range applied {
+		if !known[version] {
+			return nil, fmt.Errorf("database has migration %d applied which this build does not know about", version)
+		}
+	}
+	return statuses, nil
+}
+
+// applyMigration runs one migration in its own transaction and records the result
+func applyMigration(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	if up {
+		if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+			return fmt.Errorf("applying migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+			m.Version, m.Name, m.Checksum,
+		)
+	} else {
+		if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+			return fmt.Errorf("reverting migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkAppliedChecksums refuses to continue if an applied migration has since been edited
+func checkAppliedChecksums(statuses []MigrationStatus) error {
+	for _, s := range statuses {
+		if s.ChecksumMismatch {
+			return fmt.Errorf("migration %d_%s was modified after it was applied", s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// MigrateUp applies every pending migration and returns how many were applied
+func MigrateUp() (int, error) {
+	applied := 0
+	err := withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		statuses, err := migrationStatuses(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkAppliedChecksums(statuses); err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			if s.Applied {
+				continue
+			}
+			slog.Info("applying migration", "version", s.Version, "migration", s.Name)
+			if err := applyMigration(ctx, conn, s.Migration, true); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the given number of most recently applied migrations and returns how many were reverted
+func MigrateDown(steps int) (int, error) {
+	reverted := 0
+	err := withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		statuses, err := migrationStatuses(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkAppliedChecksums(statuses); err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0 && reverted < steps; i-- {
+			s := statuses[i]
+			if !s.Applied {
+				continue
+			}
+			slog.Info("reverting migration", "version", s.Version, "migration", s.Name)
+			if err := applyMigration(ctx, conn, s.Migration, false); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// RedoMigration reverts and re-applies the most recently applied migration
+func RedoMigration() error {
+	return withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		statuses, err := migrationStatuses(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkAppliedChecksums(statuses); err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0; i-- {
+			s := statuses[i]
+			if !s.Applied {
+				continue
+			}
+			slog.Info("redoing migration", "version", s.Version, "migration", s.Name)
+			if err := applyMigration(ctx, conn, s.Migration, false); err != nil {
+				return err
+			}
+			return applyMigration(ctx, conn, s.Migration, true)
+		}
+		return fmt.Errorf("no applied migrations to redo")
+	})
+}
+
+// MigrationStatuses reports the state of every known migration
+func MigrationStatuses() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		var err error
+		statuses, err = migrationStatuses(ctx, conn)
+		return err
+	})
+	return statuses, err
+}
+
+// PendingMigrations returns how many known migrations have not been applied yet.
+// Unlike MigrationStatuses it does not take the migration lock, so it is cheap enough for health checks.
+func PendingMigrations(ctx context.Context, db *sql.DB) (int, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	statuses, err := migrationStatuses(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkAppliedChecksums(statuses); err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, s := range statuses {
+		if !s.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
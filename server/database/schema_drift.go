@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+// driftScratchSchema is where the migrations are replayed to build the expected catalog.
+// It only ever exists inside a transaction that is rolled back.
+const driftScratchSchema = "schema_drift_expected"
+
+// schemaCatalog is the part of a Postgres schema the drift check compares
+type schemaCatalog struct {
+	// columns maps "table.column" to its type and nullability
+	columns map[string]string
+	// constraints holds "table: definition" for every constraint
+	constraints map[string]bool
+}
+
+// readCatalog introspects the tables, columns and constraints of the schema currently first on the search_path
+func readCatalog(ctx context.Context, tx *sql.Tx) (schemaCatalog, error) {
+	catalog := schemaCatalog{columns: map[string]string{}, constraints: map[string]bool{}}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		WHERE c.relnamespace = current_schema()::regnamespace
+		  AND c.relkind = 'r'
+		  AND c.relname <> 'schema_migrations'
+		  AND a.attnum > 0
+		  AND NOT a.attisdropped
+	`)
+	if err != nil {
+		return catalog, err
+	}
+	for rows.Next() {
+		var table, column, dataType string
+		var notNull bool
+		if err := rows.Scan(&table, &column, &dataType, &notNull); err != nil {
+			rows.Close()
+			return catalog, err
+		}
+		if notNull {
+			dataType += " NOT NULL"
+		}
+		catalog.columns[table+"."+column] = dataType
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return catalog, err
+	}
+
+	// Constraints are compared by definition rather than name, since older databases may have named them differently
+	rows, err = tx.QueryContext(ctx, `
+		SELECT c.relname, pg_get_constraintdef(con.oid)
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		WHERE c.relnamespace = current_schema()::regnamespace
+		  AND c.relname <> 'schema_migrations'
+	`)
+	if err != nil {
+		return catalog, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, definition string
+		if err := rows.Scan(&table, &definition); err != nil {
+			return catalog, err
+		}
+		catalog.constraints[table+": "+definition] = true
+	}
+	return catalog, rows.Err()
+}
+
+// diffCatalogs describes every way the live catalog differs from the expected one
+func diffCatalogs(expected, live schemaCatalog) []string {
+	var drift []string
+
+	for column, want := range expected.columns {
+		got, ok := live.columns[column]
+		if !ok {
+			drift = append(drift, fmt.Sprintf("missing column %s (%s)", column, want))
+		} else if got != want {
+			drift = append(drift, fmt.Sprintf("column %s is %s, expected %s", column, got, want))
+		}
+	}
+	for column, got := range live.columns {
+		if _, ok := expected.columns[column]; !ok {
+			drift = append(drift, fmt.Sprintf("unexpected column %s (%s)", column, got))
+		}
+	}
+
+	for constraint := range expected.constraints {
+		if !live.constraints[constraint] {
+			drift = append(drift, "missing constraint on "+constraint)
+		}
+	}
+	for constraint := range live.constraints {
+		if !expected.constraints[constraint] {
+			drift = append(drift, "unexpected constraint on "+constraint)
+		}
+	}
+
+	sort.Strings(drift)
+	return drift
+}
+
+// CheckSchemaDrift compares the live database against the schema the migrations produce and returns the differences.
+// The expected schema is built by replaying every migration into a scratch schema inside a transaction that is
+// rolled back, so the migrations stay the only definition of the schema.
+func CheckSchemaDrift() ([]string, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []string
+	err = withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback() // Always rolled back; the scratch schema must never persist
+
+		live, err := readCatalog(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("reading live schema: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "CREATE SCHEMA "+driftScratchSchema); err != nil {
+			return fmt.Errorf("creating scratch schema: %w", err)
+		}
+		// The live schema stays on the path after the scratch one so extension objects installed there,
+		// such as pg_trgm's operator classes, resolve during the replay
+		var liveSchema string
+		if err := tx.QueryRowContext(ctx, "SELECT current_schema()").Scan(&liveSchema); err != nil {
+			return err
+		}
+		searchPath := driftScratchSchema + ", " + pq.QuoteIdentifier(liveSchema)
+		if _, err := tx.ExecContext(ctx, "SET LOCAL search_path TO "+searchPath); err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+				return fmt.Errorf("replaying migration %d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+
+		expected, err := readCatalog(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("reading expected schema: %w", err)
+		}
+
+		drift = diffCatalogs(expected, live)
+		return nil
+	})
+	return drift, err
+}
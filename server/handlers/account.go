@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/utils"
+)
+
+// ExportDataHandler returns the authenticated user's personal data as JSON, or as a ZIP archive with ?format=zip
+func (s *Server) ExportDataHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := s.users.ExportUserData(r.Context(), principal.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("User not found"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error collecting user data", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error exporting data"))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "personal data exported")
+	filename := fmt.Sprintf("user-%d-export-%s", principal.UserID, export.ExportedAt.Format("20060102"))
+
+	if r.URL.Query().Get("format") != "zip" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(export)
+		return
+	}
+
+	// One JSON file per section so the archive is easy to browse
+	files := map[string]interface{}{
+		"profile.json":   map[string]interface{}{"profile": export.Profile, "created_at": export.CreatedAt},
+		"addresses.json": export.Addresses,
+		"cart.json":      export.Cart,
+		"orders.json":    export.Orders,
+	}
+	if export.Products != nil {
+		files["products.json"] = export.Products
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+
+	zw := zip.NewWriter(w)
+	for name, data := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error writing export archive", "err", err)
+			return
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			slog.ErrorContext(r.Context(), "error writing export archive", "err", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		slog.ErrorContext(r.Context(), "error finishing export archive", "err", err)
+	}
+}
+
+// DeleteAccountHandler deletes the authenticated user's account.
+// The account is anonymized rather than removed; see store.UserStore.DeleteAccount.
+func (s *Server) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
+		return
+	}
+
+	if !s.checkCurrentPassword(w, r, principal.UserID, input.CurrentPassword) {
+		return
+	}
+
+	// Replace the password with one nobody knows so the account can never be logged into again
+	unusable, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating password", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(unusable), bcrypt.DefaultCost)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error hashing password", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	err = s.users.DeleteAccount(r.Context(), principal.UserID, string(hashedPassword))
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("User not found"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error deleting account", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error deleting account"))
+		return
+	}
+
+	s.recordAuthEvent(r.Context(), "account_deleted", "", utils.ClientIP(r), map[string]interface{}{"user_id": principal.UserID})
+	slog.InfoContext(r.Context(), "account deleted")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account deleted"})
+}
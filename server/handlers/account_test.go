@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/rythmokay/golang/server/models"
+)
+
+// deleteAccount deletes a user's account through DeleteAccountHandler
+func deleteAccount(t *testing.T, s *Server, id int, role, password string, want int) {
+	t.Helper()
+	r := jsonRequest(t, http.MethodDelete, "/api/profile/delete", map[string]string{"current_password": password})
+	serve(t, s.DeleteAccountHandler, asUser(r, id, role), want)
+}
+
+func TestExportDataContainsProfile(t *testing.T) {
+	s, _ := newTestServer(t)
+	id := userID(signup(t, s, "ada@example.com", models.RoleCustomer))
+
+	rec := httptest.NewRecorder()
+	s.ExportDataHandler(rec, asUser(httptest.NewRequest(http.MethodGet, "/api/profile/export", nil), id, models.RoleCustomer))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var export models.UserDataExport
+	if err := json.NewDecoder(rec.Body).Decode(&export); err != nil {
+		t.Fatal(err)
+	}
+	if export.Profile.Email != "ada@example.com" || export.Profile.Password != "" {
+		t.Errorf("profile = %+v, want the user's details without the password hash", export.Profile)
+	}
+}
+
+func TestDeleteAccountEndsLoginsAndSessions(t *testing.T) {
+	s, _ := newTestServer(t)
+	body := signup(t, s, "ada@example.com", models.RoleCustomer)
+	id := userID(body)
+
+	deleteAccount(t, s, id, models.RoleCustomer, "wrong password", http.StatusForbidden)
+	deleteAccount(t, s, id, models.RoleCustomer, "correct horse", http.StatusOK)
+
+	login(t, s, "ada@example.com", "correct horse", http.StatusUnauthorized)
+	refresh(t, s, body["refresh_token"].(string), http.StatusUnauthorized)
+
+	// The address is free for a new account
+	signup(t, s, "ada@example.com", models.RoleCustomer)
+}
+
+func TestDeleteAccountRevokesAccessTokens(t *testing.T) {
+	s, _ := newTestServer(t)
+	body := signup(t, s, "ada@example.com", models.RoleCustomer)
+	id := userID(body)
+
+	getProfile := func(want int) {
+		r := httptest.NewRequest(http.MethodGet, "/api/profile", nil)
+		r.Header.Set("Authorization", "Bearer "+body["token"].(string))
+		serve(t, s.auth.Middleware(s.GetProfile), r, want)
+	}
+	getProfile(http.StatusOK)
+	deleteAccount(t, s, id, models.RoleCustomer, "correct horse", http.StatusOK)
+	getProfile(http.StatusUnauthorized)
+}
+
+func TestDeleteSellerUnlistsProducts(t *testing.T) {
+	s, stores := newTestServer(t)
+	ctx := context.Background()
+	id := userID(signup(t, s, "grace@example.com", models.RoleSeller))
+
+	lamp := createProduct(t, stores, id, "Brass lamp")
+
+	// visible reports for each storefront lookup whether the lamp shows up in it
+	visible := func() map[string]bool {
+		page := httptest.NewRequest(http.MethodGet, "/api/shop/products/"+strconv.Itoa(lamp.ID), nil)
+		page.SetPathValue("id", strconv.Itoa(lamp.ID))
+		rec := httptest.NewRecorder()
+		s.GetProductDetailsHandler(rec, page)
+
+		get := func(h http.HandlerFunc, target string) map[string]interface{} {
+			return serve(t, h, httptest.NewRequest(http.MethodGet, target, nil), http.StatusOK)
+		}
+		catalog := get(s.GetAllProductsHandler, "/api/shop/products")
+		search := get(s.SearchProductsHandler, "/api/shop/search?q=brass")
+		suggestions := get(s.SuggestHandler, "/api/shop/suggest?q=brass")["suggestions"].(map[string]interface{})
+		return map[string]bool{
+			"product page": rec.Code == http.StatusOK,
+			"catalog":      catalog["total"] == float64(1),
+			"search":       search["total"] == float64(1),
+			"suggestions":  len(suggestions["products"].([]interface{})) == 1,
+		}
+	}
+	for lookup, found := range visible() {
+		if !found {
+			t.Fatalf("before deletion the lamp is missing from the %s", lookup)
+		}
+	}
+
+	deleteAccount(t, s, id, models.RoleSeller, "correct horse", http.StatusOK)
+
+	for lookup, found := range visible() {
+		if found {
+			t.Errorf("after deletion the lamp is still in the %s", lookup)
+		}
+	}
+	// The product itself is kept for the orders that refer to it
+	if products, err := stores.Products.ListSellerProducts(ctx, id); err != nil || len(products) != 1 {
+		t.Errorf("seller products = %v, %v; want the lamp kept", products, err)
+	}
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/rythmokay/golang/server/store"
+)
+
+// recordAuthEvent writes a security-relevant event to the audit log.
+// Failures are logged rather than returned so auditing never blocks the request.
+func (s *Server) recordAuthEvent(ctx context.Context, event, email, ip string, details map[string]interface{}) {
+	ctx, cancel := s.detach(ctx)
+	defer cancel()
+	err := s.audit.RecordEvent(ctx, store.AuthEvent{Event: event, Email: email, IP: ip, Details: details})
+	if err != nil {
+		slog.ErrorContext(ctx, "error writing audit record", "event", event, "err", err)
+	}
+}
@@ -1,178 +1,379 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
-	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
-	"github.com/rythmokay/golang/server/config"
-	"github.com/rythmokay/golang/server/database"
+	"github.com/rythmokay/golang/server/apierror"
 	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/utils"
 )
 
 // SignupHandler handles user registration
-func SignupHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("📝 Received signup request")
+func (s *Server) SignupHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Method not allowed"})
+		apierror.Write(w, r, apierror.MethodNotAllowed())
 		return
 	}
 
 	var user models.User
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid request format"})
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
 		return
 	}
 
-	// Validate required fields
-	if strings.TrimSpace(user.Name) == "" || strings.TrimSpace(user.Email) == "" || user.Password == "" || user.Role == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "All fields are required"})
-		return
-	}
-
-	// Validate role
-	if user.Role != "seller" && user.Role != "customer" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid role. Must be 'seller' or 'customer'"})
-		return
-	}
-
-	// Validate password length
-	if len(user.Password) < config.MinPasswordLength {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Password must be at least 6 characters"})
+	// Validate every field, reporting all problems at once
+	if err := user.ValidateSignup(s.cfg.Auth.MinPasswordLength); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
 	// Check if email already exists
-	var existingID int
-	log.Printf("📧 Checking if email exists: %s", user.Email)
-	err := database.DB.QueryRow("SELECT id FROM users WHERE email = $1", user.Email).Scan(&existingID)
-
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("❌ Database error checking email: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Internal server error"})
+	_, err := s.users.GetUserByEmail(r.Context(), user.Email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		slog.ErrorContext(r.Context(), "database error checking email", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
 		return
 	}
 
 	if err == nil {
-		log.Printf("❌ Email already exists")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Email already registered"})
+		apierror.Write(w, r, apierror.Conflict("Email already registered"))
 		return
 	}
 
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("Error hashing password: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Error processing password"})
+		slog.ErrorContext(r.Context(), "error hashing password", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error processing password"))
 		return
 	}
 
 	// Insert new user and get the ID
-	var userID int
-	log.Printf("👤 Creating new user with name: %s, email: %s, role: %s", user.Name, user.Email, user.Role)
+	user.Password = string(hashedPassword)
+	err = s.users.CreateUser(r.Context(), &user)
+	if errors.Is(err, store.ErrEmailTaken) {
+		apierror.Write(w, r, apierror.From(err).WithMessage("Email already registered"))
+		return
+	}
+	if errors.Is(err, store.ErrInvalid) {
+		apierror.Write(w, r, apierror.From(err).WithMessage("Name or email is invalid"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error creating user", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error creating user"))
+		return
+	}
+	userID := user.ID
 
-	err = database.DB.QueryRow(
-		"INSERT INTO users (name, email, password, role) VALUES ($1, $2, $3, $4) RETURNING id",
-		user.Name, user.Email, string(hashedPassword), user.Role,
-	).Scan(&userID)
+	slog.InfoContext(r.Context(), "user created", "user_id", userID, "role", user.Role)
 
+	// Ask the user to confirm their email; they can request another link if this one fails
+	if err := s.sendVerificationEmail(r.Context(), userID, user.Email); err != nil {
+		slog.ErrorContext(r.Context(), "error sending verification email", "err", err)
+	}
+
+	// Sign the new user in straight away
+	session, err := s.issueSession(r.Context(), userID, user.Role)
 	if err != nil {
-		log.Printf("❌ Error creating user: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Error creating user"})
+		slog.ErrorContext(r.Context(), "error generating token", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
 		return
 	}
 
-	log.Printf("✅ User created successfully with ID: %d", userID)
-
 	// Return success response
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "User registered successfully",
-		"id":      userID,
-		"name":    user.Name,
-		"email":   user.Email,
-		"role":    user.Role,
+		"message":            "User registered successfully",
+		"id":                 userID,
+		"name":               user.Name,
+		"email":              user.Email,
+		"role":               user.Role,
+		"email_verified":     false,
+		"token":              session.AccessToken,
+		"expires_at":         session.ExpiresAt,
+		"refresh_token":      session.RefreshToken,
+		"refresh_expires_at": session.RefreshExpiresAt,
 	})
 }
 
 // LoginHandler handles user login
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("🔑 Received login request")
+func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, apierror.MethodNotAllowed())
 		return
 	}
 
 	var input models.User
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
 		return
 	}
 
 	// Check for empty fields
 	if input.Email == "" || input.Password == "" {
-		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Email and password are required"))
 		return
 	}
 
-	var stored models.User
-	err := database.DB.QueryRow("SELECT id, name, email, password, role FROM users WHERE email = $1", input.Email).
-		Scan(&stored.ID, &stored.Name, &stored.Email, &stored.Password, &stored.Role)
+	// Refuse attempts while the account or client IP is locked out
+	ip := utils.ClientIP(r)
+	if !s.loginAllowed(w, r, input.Email, ip) {
+		return
+	}
+
+	stored, err := s.users.GetUserByEmail(r.Context(), input.Email)
 
 	// Handle no user found case
-	if err == sql.ErrNoRows {
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid email or password"})
+	if errors.Is(err, store.ErrNotFound) {
+		s.recordLoginFailure(r.Context(), input.Email, ip)
+		apierror.Write(w, r, apierror.Unauthorized("Invalid email or password"))
 		return
 	}
 
 	// Handle database errors
 	if err != nil {
-		log.Printf("Database error: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Internal server error"})
+		slog.ErrorContext(r.Context(), "error fetching user for login", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
 		return
 	}
 
 	// Compare password
-	log.Printf("🔐 Comparing password for user: %s", input.Email)
 	if err := bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte(input.Password)); err != nil {
-		log.Printf("❌ Invalid password for user: %s", input.Email)
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid email or password"})
+		slog.InfoContext(r.Context(), "invalid password", "email", input.Email)
+		s.recordLoginFailure(r.Context(), input.Email, ip)
+		apierror.Write(w, r, apierror.Unauthorized("Invalid email or password"))
+		return
+	}
+
+	// Sellers with two-factor enabled must complete a challenge before getting a session.
+	// Their failures are only cleared once it is passed, so logging in again cannot reset a code-guessing attack.
+	if stored.Role == models.RoleSeller && stored.TwoFactorEnabled {
+		challenge, expiresAt, err := s.createTwoFactorChallenge(r.Context(), stored.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error creating two-factor challenge", "err", err)
+			apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+			return
+		}
+
+		slog.InfoContext(r.Context(), "two-factor challenge issued", "user_id", stored.ID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":             "Two-factor authentication required",
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_at":          expiresAt,
+		})
+		return
+	}
+
+	// Issue an access token and a refresh token for the new session
+	session, err := s.issueSession(r.Context(), stored.ID, stored.Role)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating token", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
 		return
 	}
-	log.Printf("✅ Password correct for user: %s", input.Email)
 
-	// Generate a simple token (in a real app, use JWT or other secure token)
-	token := "auth-token-" + stored.Email // Simple token for demo purposes
+	s.clearLoginFailures(r.Context(), input.Email)
 
 	// Log successful login with role information
-	log.Printf("✅ Login successful for user: %s with role: %s", stored.Email, stored.Role)
+	slog.InfoContext(r.Context(), "login successful", "user_id", stored.ID, "role", stored.Role)
 
 	// Successful login
 	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loginResponse(stored, session))
+}
+
+// loginResponse is the body returned when a user has been signed in
+func loginResponse(user models.User, session sessionTokens) map[string]interface{} {
+	return map[string]interface{}{
+		"message":            "Login successful",
+		"id":                 user.ID,
+		"name":               user.Name,
+		"email":              user.Email,
+		"role":               user.Role,
+		"email_verified":     user.EmailVerified,
+		"token":              session.AccessToken,
+		"expires_at":         session.ExpiresAt,
+		"refresh_token":      session.RefreshToken,
+		"refresh_expires_at": session.RefreshExpiresAt,
+	}
+}
+
+// sessionTokens are the credentials handed to a client for one signed-in session
+type sessionTokens struct {
+	AccessToken      string
+	ExpiresAt        time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// issueSession creates an access token and the first refresh token of a new token family
+func (s *Server) issueSession(ctx context.Context, userID int, role string) (sessionTokens, error) {
+	familyID, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	session, tokenHash, err := s.newSessionTokens(userID, role, familyID)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	err = s.sessions.CreateRefreshToken(ctx, store.RefreshToken{
+		UserID: userID, FamilyID: familyID, TokenHash: tokenHash, ExpiresAt: session.RefreshExpiresAt,
+	})
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	return session, nil
+}
+
+// newSessionTokens creates an access token and a refresh token in the given family.
+// It returns the hash of the refresh token, which is all that is stored.
+func (s *Server) newSessionTokens(userID int, role, familyID string) (sessionTokens, string, error) {
+	var session sessionTokens
+	var err error
+
+	session.AccessToken, session.ExpiresAt, err = s.auth.GenerateToken(userID, role, familyID)
+	if err != nil {
+		return sessionTokens{}, "", err
+	}
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return sessionTokens{}, "", err
+	}
+	session.RefreshToken = token
+	session.RefreshExpiresAt = time.Now().Add(s.cfg.Auth.RefreshTokenTTL)
+	return session, tokenHash, nil
+}
+
+// RefreshHandler exchanges a refresh token for a new access token and a rotated refresh token.
+// Presenting a refresh token that was already rotated revokes its whole family.
+func (s *Server) RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		apierror.Write(w, r, apierror.BadRequest("Refresh token is required"))
+		return
+	}
+
+	// The new refresh token is stored in place of the presented one; its access token is signed once the
+	// rotation tells us who the session belongs to
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating refresh token", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+	expiresAt := time.Now().Add(s.cfg.Auth.RefreshTokenTTL)
+
+	rotated, err := s.sessions.RotateRefreshToken(r.Context(), utils.HashToken(input.RefreshToken), tokenHash, expiresAt)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		apierror.Write(w, r, apierror.Unauthorized("Invalid refresh token"))
+		return
+	case errors.Is(err, store.ErrTokenReused):
+		// A revoked token being presented again means it was stolen or replayed
+		slog.WarnContext(r.Context(), "refresh token reuse detected, revoked token family", "user_id", rotated.UserID)
+		apierror.Write(w, r, apierror.Unauthorized("Refresh token has been revoked"))
+		return
+	case errors.Is(err, store.ErrTokenExpired):
+		apierror.Write(w, r, apierror.Unauthorized("Refresh token has expired"))
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "error rotating refresh token", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	session := sessionTokens{RefreshToken: token, RefreshExpiresAt: expiresAt}
+	session.AccessToken, session.ExpiresAt, err = s.auth.GenerateToken(rotated.UserID, rotated.Role, rotated.FamilyID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating token", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Login successful",
-		"id":      stored.ID,
-		"name":    stored.Name,
-		"email":   stored.Email,
-		"role":    stored.Role,
-		"token":   token,
+		"token":              session.AccessToken,
+		"expires_at":         session.ExpiresAt,
+		"refresh_token":      session.RefreshToken,
+		"refresh_expires_at": session.RefreshExpiresAt,
 	})
 }
+
+// LogoutHandler revokes the session that the given refresh token belongs to
+func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		apierror.Write(w, r, apierror.BadRequest("Refresh token is required"))
+		return
+	}
+
+	// Unknown tokens are treated as already logged out
+	err := s.sessions.RevokeSession(r.Context(), principal.UserID, utils.HashToken(input.RefreshToken))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		slog.ErrorContext(r.Context(), "error revoking token family", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+}
+
+// LogoutAllHandler revokes every session of the authenticated user
+func (s *Server) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.sessions.RevokeUserSessions(r.Context(), principal.UserID, ""); err != nil {
+		slog.ErrorContext(r.Context(), "error revoking sessions", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "logged out all devices")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out of all devices"})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rythmokay/golang/server/models"
+)
+
+// login logs in through LoginHandler and fails the test unless it answers with the wanted status
+func login(t *testing.T, s *Server, email, password string, want int) map[string]interface{} {
+	t.Helper()
+	return serve(t, s.LoginHandler, jsonRequest(t, http.MethodPost, "/api/login", map[string]string{
+		"email": email, "password": password,
+	}), want)
+}
+
+// refresh exchanges a refresh token through RefreshHandler
+func refresh(t *testing.T, s *Server, token string, want int) map[string]interface{} {
+	t.Helper()
+	return serve(t, s.RefreshHandler, jsonRequest(t, http.MethodPost, "/api/auth/refresh", map[string]string{
+		"refresh_token": token,
+	}), want)
+}
+
+func TestLoginChecksPassword(t *testing.T) {
+	s, _ := newTestServer(t)
+	signup(t, s, "ada@example.com", models.RoleCustomer)
+
+	login(t, s, "ada@example.com", "wrong password", http.StatusUnauthorized)
+	login(t, s, "nobody@example.com", "correct horse", http.StatusUnauthorized)
+	body := login(t, s, "ada@example.com", "correct horse", http.StatusOK)
+	if body["token"] == "" || body["refresh_token"] == "" {
+		t.Errorf("login response has no session: %v", body)
+	}
+}
+
+func TestRefreshRotatesTokenAndRevokesFamilyOnReuse(t *testing.T) {
+	s, _ := newTestServer(t)
+	first := signup(t, s, "ada@example.com", models.RoleCustomer)["refresh_token"].(string)
+
+	second := refresh(t, s, first, http.StatusOK)["refresh_token"].(string)
+	if second == first {
+		t.Fatal("refresh returned the same refresh token")
+	}
+
+	// Presenting the rotated token again revokes the whole family, including the token it was replaced by
+	refresh(t, s, first, http.StatusUnauthorized)
+	refresh(t, s, second, http.StatusUnauthorized)
+
+	refresh(t, s, "not-a-token", http.StatusUnauthorized)
+}
+
+func TestLogoutRevokesOnlyThatSession(t *testing.T) {
+	s, _ := newTestServer(t)
+	body := signup(t, s, "ada@example.com", models.RoleCustomer)
+	id := userID(body)
+	phone := body["refresh_token"].(string)
+	laptop := login(t, s, "ada@example.com", "correct horse", http.StatusOK)["refresh_token"].(string)
+
+	r := jsonRequest(t, http.MethodPost, "/api/auth/logout", map[string]string{"refresh_token": phone})
+	serve(t, s.LogoutHandler, asUser(r, id, models.RoleCustomer), http.StatusOK)
+
+	refresh(t, s, phone, http.StatusUnauthorized)
+	refresh(t, s, laptop, http.StatusOK)
+}
+
+func TestLogoutAllRevokesEverySession(t *testing.T) {
+	s, _ := newTestServer(t)
+	body := signup(t, s, "ada@example.com", models.RoleCustomer)
+	id := userID(body)
+	laptop := login(t, s, "ada@example.com", "correct horse", http.StatusOK)["refresh_token"].(string)
+
+	r := jsonRequest(t, http.MethodPost, "/api/auth/logout-all", nil)
+	serve(t, s.LogoutAllHandler, asUser(r, id, models.RoleCustomer), http.StatusOK)
+
+	refresh(t, s, body["refresh_token"].(string), http.StatusUnauthorized)
+	refresh(t, s, laptop, http.StatusUnauthorized)
+}
+
+func TestAccessTokenStopsWorkingAfterLogout(t *testing.T) {
+	s, _ := newTestServer(t)
+	phone := signup(t, s, "ada@example.com", models.RoleCustomer)
+	laptop := login(t, s, "ada@example.com", "correct horse", http.StatusOK)
+
+	// bearer sends r through the authentication middleware with the access token of a session
+	bearer := func(h http.HandlerFunc, r *http.Request, session map[string]interface{}, want int) {
+		t.Helper()
+		r.Header.Set("Authorization", "Bearer "+session["token"].(string))
+		serve(t, s.auth.Middleware(h), r, want)
+	}
+
+	bearer(s.LogoutHandler, jsonRequest(t, http.MethodPost, "/api/auth/logout", map[string]string{
+		"refresh_token": phone["refresh_token"].(string),
+	}), phone, http.StatusOK)
+
+	bearer(s.GetProfile, jsonRequest(t, http.MethodGet, "/api/profile", nil), phone, http.StatusUnauthorized)
+	bearer(s.GetProfile, jsonRequest(t, http.MethodGet, "/api/profile", nil), laptop, http.StatusOK)
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// CreateCategoryHandler adds a category to the tree (administrators only).
+// The slug defaults to one derived from the name; a missing parent_id makes a top-level category.
+func (s *Server) CreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
+		return
+	}
+	if !s.prepareCategory(w, r, &category) {
+		return
+	}
+
+	err := s.categories.CreateCategory(r.Context(), &category)
+	if errors.Is(err, store.ErrCategoryExists) {
+		apierror.Write(w, r, apierror.Conflict("A category with this slug, or a sibling with this name, already exists"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error creating category", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error creating category"))
+		return
+	}
+	slog.InfoContext(r.Context(), "category created", "category_id", category.ID, "slug", category.Slug)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// UpdateCategoryHandler renames, moves or reorders a category (administrators only).
+// The body replaces the category's name, slug, parent_id and position; products keep their category.
+func (s *Server) UpdateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
+		return
+	}
+	if category.ID == 0 {
+		apierror.Write(w, r, apierror.BadRequest("Category ID is required"))
+		return
+	}
+	if !s.prepareCategory(w, r, &category) {
+		return
+	}
+
+	err := s.categories.UpdateCategory(r.Context(), &category)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		apierror.Write(w, r, apierror.NotFound("Category not found"))
+		return
+	case errors.Is(err, store.ErrCategoryCycle):
+		apierror.Write(w, r, apierror.Validation("Request validation failed",
+			apierror.FieldError{Field: "parent_id", Message: "cannot be the category itself or one of its subcategories"}))
+		return
+	case errors.Is(err, store.ErrCategoryExists):
+		apierror.Write(w, r, apierror.Conflict("A category with this slug, or a sibling with this name, already exists"))
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "error updating category", "category_id", category.ID, "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error updating category"))
+		return
+	}
+	slog.InfoContext(r.Context(), "category updated", "category_id", category.ID, "slug", category.Slug)
+
+	// Return the saved category with its product count
+	updated, err := s.categories.GetCategory(r.Context(), category.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error fetching updated category", "category_id", category.ID, "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error fetching category"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteCategoryHandler removes an empty category (administrators only). Categories that still have
+// subcategories or products are refused, so nothing is left without a category.
+func (s *Server) DeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	categoryID, err := strconv.Atoi(r.URL.Query().Get("category_id"))
+	if err != nil || categoryID <= 0 {
+		apierror.Write(w, r, apierror.BadRequest("Invalid category ID"))
+		return
+	}
+
+	err = s.categories.DeleteCategory(r.Context(), categoryID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Category not found"))
+		return
+	}
+	if errors.Is(err, store.ErrCategoryInUse) {
+		apierror.Write(w, r, apierror.Conflict("Category still has subcategories or products; move them first"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error deleting category", "category_id", categoryID, "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error deleting category"))
+		return
+	}
+	slog.InfoContext(r.Context(), "category deleted", "category_id", categoryID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Category deleted successfully"})
+}
+
+// prepareCategory normalizes and validates a category sent by an administrator and checks that its parent
+// exists. It writes an error response and returns false when the category is not acceptable.
+func (s *Server) prepareCategory(w http.ResponseWriter, r *http.Request, category *models.Category) bool {
+	category.Name = models.NormalizeCategoryName(category.Name)
+	if category.Slug == "" {
+		category.Slug = models.Slugify(category.Name)
+	}
+	category.ProductCount, category.Children = 0, nil
+
+	if err := category.Validate(); err != nil {
+		apierror.Write(w, r, err)
+		return false
+	}
+	if category.ParentID == nil {
+		return true
+	}
+
+	_, err := s.categories.GetCategory(r.Context(), *category.ParentID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.Validation("Request validation failed",
+			apierror.FieldError{Field: "parent_id", Message: "must be an existing category"}))
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error looking up parent category", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error looking up category"))
+		return false
+	}
+	return true
+}
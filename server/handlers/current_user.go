@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/utils"
+)
+
+// currentUser returns the authenticated user for the request.
+// It writes a 401 response and returns false when the request carries no principal,
+// which only happens if a handler is mounted without Authenticator.Middleware.
+func currentUser(w http.ResponseWriter, r *http.Request) (utils.Principal, bool) {
+	principal, ok := utils.PrincipalFromContext(r.Context())
+	if !ok {
+		slog.ErrorContext(r.Context(), "no authenticated user on request", "path", r.URL.Path)
+		apierror.Write(w, r, apierror.Unauthorized("Authentication required"))
+		return utils.Principal{}, false
+	}
+	return principal, true
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/utils"
+)
+
+// sendVerificationEmail creates a verification token for the given address and emails the link to it.
+// The address becomes the user's verified email once the link is used, which is how email changes are confirmed.
+func (s *Server) sendVerificationEmail(ctx context.Context, userID int, email string) error {
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.verifications.CreateEmailVerification(ctx, userID, email, tokenHash, time.Now().Add(s.cfg.Auth.EmailVerificationTTL))
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(
+		"Please confirm your email address.\n\nVerify it here: %s?token=%s\n\nThis link expires in %s.",
+		s.cfg.EmailVerificationURL(), token, s.cfg.Auth.EmailVerificationTTL,
+	)
+	return s.mail.Send(email, "Verify your email address", body)
+}
+
+// requireVerifiedEmail writes a 403 response and returns false if the user has not verified their email
+func (s *Server) requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userID int) bool {
+	user, err := s.users.GetUserByID(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.Unauthorized("User not found"))
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error checking email verification", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return false
+	}
+	if !user.EmailVerified {
+		apierror.Write(w, r, apierror.Forbidden("Please verify your email address first"))
+		return false
+	}
+	return true
+}
+
+// VerifyEmailHandler marks a user's email as verified using a verification token
+func (s *Server) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		apierror.Write(w, r, apierror.BadRequest("Token is required"))
+		return
+	}
+
+	// Tokens issued for an email change also switch the account to the new address
+	userID, err := s.verifications.VerifyEmail(r.Context(), utils.HashToken(input.Token))
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.BadRequest("Verification link is invalid or has expired"))
+		return
+	}
+	if errors.Is(err, store.ErrEmailTaken) {
+		apierror.Write(w, r, apierror.Conflict("Email already registered"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error verifying email", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "email verified", "user_id", userID)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified successfully"})
+}
+
+// ResendVerificationHandler sends a new verification email to the authenticated user.
+// Requests are limited per user to VerificationResendInterval and VerificationResendHourlyLimit.
+func (s *Server) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := s.users.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error fetching user for verification resend", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	// Resend to the address with a pending change, if any, otherwise the current one
+	email, err := s.verifications.PendingEmailVerification(r.Context(), principal.UserID)
+	switch {
+	case errors.Is(err, store.ErrNotFound) && user.EmailVerified:
+		apierror.Write(w, r, apierror.Conflict("Email is already verified"))
+		return
+	case errors.Is(err, store.ErrNotFound):
+		email = user.Email
+	case err != nil:
+		slog.ErrorContext(r.Context(), "error fetching pending verification", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	// Rate limit based on the tokens already issued to this user
+	sent, err := s.verifications.ListEmailVerificationTimes(r.Context(), principal.UserID, time.Now().Add(-time.Hour))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error checking verification rate limit", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	var retryAfter time.Duration
+	if len(sent) >= s.cfg.Auth.VerificationResendHourlyLimit {
+		retryAfter = time.Until(sent[0].Add(time.Hour))
+	} else if len(sent) > 0 {
+		retryAfter = time.Until(sent[len(sent)-1].Add(s.cfg.Auth.VerificationResendInterval))
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		apierror.Write(w, r, apierror.TooManyRequests("Too many verification emails requested. Please try again later."))
+		return
+	}
+
+	if err := s.sendVerificationEmail(r.Context(), principal.UserID, email); err != nil {
+		slog.ErrorContext(r.Context(), "error sending verification email", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Could not send verification email"))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rythmokay/golang/server/models"
+)
+
+// verifyEmail confirms an address through VerifyEmailHandler
+func verifyEmail(t *testing.T, s *Server, token string, want int) {
+	t.Helper()
+	serve(t, s.VerifyEmailHandler, jsonRequest(t, http.MethodPost, "/api/auth/verify-email", map[string]string{
+		"token": token,
+	}), want)
+}
+
+func TestSignupEmailVerification(t *testing.T) {
+	s, stores := newTestServer(t)
+	mail := captureMail(s)
+	id := userID(signup(t, s, "ada@example.com", models.RoleCustomer))
+	token := mail.lastToken(t, "ada@example.com")
+
+	verifyEmail(t, s, token, http.StatusOK)
+	verifyEmail(t, s, token, http.StatusBadRequest)
+
+	user, err := stores.Users.GetUserByID(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.EmailVerified {
+		t.Error("email is not verified after following the link")
+	}
+
+	r := jsonRequest(t, http.MethodPost, "/api/auth/resend-verification", nil)
+	serve(t, s.ResendVerificationHandler, asUser(r, id, models.RoleCustomer), http.StatusConflict)
+}
+
+func TestResendVerificationIsRateLimited(t *testing.T) {
+	s, _ := newTestServer(t)
+	mail := captureMail(s)
+	id := userID(signup(t, s, "ada@example.com", models.RoleCustomer))
+	first := mail.lastToken(t, "ada@example.com")
+
+	// The signup email was just sent, so a resend has to wait for the interval
+	r := jsonRequest(t, http.MethodPost, "/api/auth/resend-verification", nil)
+	serve(t, s.ResendVerificationHandler, asUser(r, id, models.RoleCustomer), http.StatusTooManyRequests)
+
+	s.cfg.Auth.VerificationResendInterval = 0
+	r = jsonRequest(t, http.MethodPost, "/api/auth/resend-verification", nil)
+	serve(t, s.ResendVerificationHandler, asUser(r, id, models.RoleCustomer), http.StatusOK)
+
+	// Using one link retires the others
+	verifyEmail(t, s, mail.lastToken(t, "ada@example.com"), http.StatusOK)
+	verifyEmail(t, s, first, http.StatusBadRequest)
+}
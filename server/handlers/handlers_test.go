@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rythmokay/golang/server/config"
+	"github.com/rythmokay/golang/server/mailer"
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/store/memory"
+	"github.com/rythmokay/golang/server/utils"
+)
+
+// newTestServer returns a Server on empty in-memory stores with the default configuration
+func newTestServer(t *testing.T) (*Server, store.Stores) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "test-secret"
+	stores := memory.NewStores()
+	return NewServer(&cfg, utils.NewAuthenticator(cfg.Auth, stores.Users, stores.Sessions), stores, mailer.LogSender{}, nil), stores
+}
+
+// asUser returns r as if Authenticator.Middleware had authenticated it for the given user
+func asUser(r *http.Request, userID int, role string) *http.Request {
+	return r.WithContext(utils.WithPrincipal(r.Context(), utils.Principal{UserID: userID, Role: role}))
+}
+
+// jsonRequest returns a request with body encoded as JSON
+func jsonRequest(t *testing.T, method, target string, body interface{}) *http.Request {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewRequest(method, target, bytes.NewReader(data))
+}
+
+// serve runs h on r and fails the test unless it answers with the wanted status.
+// It returns the decoded JSON body.
+func serve(t *testing.T, h http.HandlerFunc, r *http.Request, want int) map[string]interface{} {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h(rec, r)
+	if rec.Code != want {
+		t.Fatalf("%s %s: status = %d, want %d; body %s", r.Method, r.URL, rec.Code, want, rec.Body)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: decoding body %q: %v", r.Method, r.URL, rec.Body, err)
+	}
+	return body
+}
+
+// signup registers a user through SignupHandler and returns the response body
+func signup(t *testing.T, s *Server, email, role string) map[string]interface{} {
+	t.Helper()
+	return serve(t, s.SignupHandler, jsonRequest(t, http.MethodPost, "/api/signup", map[string]string{
+		"name": "Test User", "email": email, "password": "correct horse", "role": role,
+	}), http.StatusCreated)
+}
+
+// userID returns the id from a signup or login response
+func userID(body map[string]interface{}) int {
+	return int(body["id"].(float64))
+}
+
+// createProduct lists a product for the seller in a new category
+func createProduct(t *testing.T, stores store.Stores, sellerID int, name string) models.Product {
+	t.Helper()
+	ctx := context.Background()
+	category := models.Category{Name: name + " category", Slug: models.Slugify(name)}
+	if err := stores.Categories.CreateCategory(ctx, &category); err != nil {
+		t.Fatal(err)
+	}
+	p := models.Product{
+		SellerID: sellerID, Name: name, Price: 40, Stock: 3, CategoryID: category.ID,
+		CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}
+	if err := stores.Products.CreateProduct(ctx, &p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// outbox collects the emails the handlers send
+type outbox struct {
+	mu   sync.Mutex
+	sent map[string][]string // bodies by recipient
+}
+
+// captureMail routes the mail s sends into an outbox
+func captureMail(s *Server) *outbox {
+	o := &outbox{sent: map[string][]string{}}
+	s.mail = o
+	return o
+}
+
+func (o *outbox) Send(to, subject, body string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sent[to] = append(o.sent[to], body)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`\?token=([A-Za-z0-9_-]+)`)
+
+// lastToken returns the token in the link of the latest email sent to the address
+func (o *outbox) lastToken(t *testing.T, to string) string {
+	t.Helper()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	sent := o.sent[to]
+	if len(sent) == 0 {
+		t.Fatalf("no email sent to %s", to)
+	}
+	m := linkToken.FindStringSubmatch(sent[len(sent)-1])
+	if m == nil {
+		t.Fatalf("no link in email to %s: %q", to, sent[len(sent)-1])
+	}
+	return m[1]
+}
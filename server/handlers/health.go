@@ -1,16 +1,142 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
+	"time"
+
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/database"
+)
+
+// Health check statuses
+const (
+	healthOK   = "ok"
+	healthWarn = "warn"
+	healthFail = "fail"
 )
 
-// HealthCheck handles the health check endpoint
-func HealthCheck(w http.ResponseWriter, r *http.Request) {
+// healthCheck is the result of checking one dependency
+type healthCheck struct {
+	Status string `json:"status"`
+	// Critical checks make the server unready when they fail
+	Critical  bool        `json:"critical"`
+	LatencyMS float64     `json:"latency_ms"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// poolDetails describes how busy the database connection pool is
+type poolDetails struct {
+	MaxOpen    int     `json:"max_open"`
+	Open       int     `json:"open"`
+	InUse      int     `json:"in_use"`
+	Idle       int     `json:"idle"`
+	WaitCount  int64   `json:"wait_count"`
+	WaitTimeMS int64   `json:"wait_time_ms"`
+	Saturation float64 `json:"saturation"`
+}
+
+// LiveHandler reports that the process is up and serving requests.
+// It never touches dependencies, so a database outage does not get the server restarted.
+func (s *Server) LiveHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, apierror.MethodNotAllowed())
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	json.NewEncoder(w).Encode(map[string]string{"status": healthOK})
+}
+
+// ReadyHandler reports whether the server can handle traffic, with a breakdown per dependency.
+// It returns 503 when any critical check fails.
+func (s *Server) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.Database.HealthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]healthCheck{
+		"database":   s.checkDatabase(ctx),
+		"migrations": s.checkMigrations(ctx),
+		"pool":       s.checkPool(),
+	}
+
+	status, code := healthOK, http.StatusOK
+	for _, check := range checks {
+		if check.Status == healthFail && check.Critical {
+			status, code = healthFail, http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// checkDatabase pings Postgres
+func (s *Server) checkDatabase(ctx context.Context) healthCheck {
+	start := time.Now()
+	err := s.db.PingContext(ctx)
+	return finishCheck(ctx, healthCheck{Critical: true}, start, err, "database is unreachable")
+}
+
+// checkMigrations verifies that every migration in this build has been applied
+func (s *Server) checkMigrations(ctx context.Context) healthCheck {
+	start := time.Now()
+	pending, err := database.PendingMigrations(ctx, s.db)
+	check := finishCheck(ctx, healthCheck{Critical: true}, start, err, "migration state could not be read")
+	if err == nil {
+		check.Details = map[string]int{"pending": pending}
+		if pending > 0 {
+			check.Status = healthFail
+			check.Error = "migrations have not been applied"
+		}
+	}
+	return check
+}
+
+// checkPool reports connection pool usage. A saturated pool only warns: requests still queue for a connection.
+func (s *Server) checkPool() healthCheck {
+	stats := s.db.Stats()
+	details := poolDetails{
+		MaxOpen:    stats.MaxOpenConnections,
+		Open:       stats.OpenConnections,
+		InUse:      stats.InUse,
+		Idle:       stats.Idle,
+		WaitCount:  stats.WaitCount,
+		WaitTimeMS: stats.WaitDuration.Milliseconds(),
+	}
+	if stats.MaxOpenConnections > 0 {
+		details.Saturation = float64(stats.InUse) / float64(stats.MaxOpenConnections)
+	}
+
+	check := healthCheck{Status: healthOK, Details: details}
+	if details.Saturation >= 1 {
+		check.Status = healthWarn
+		check.Error = "all connections are in use"
+	}
+	return check
+}
+
+// finishCheck fills in the latency and outcome of a check that started at start.
+// The endpoint is public, so a failure is reported as failMsg and the error itself is only logged.
+func finishCheck(ctx context.Context, check healthCheck, start time.Time, err error, failMsg string) healthCheck {
+	check.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	check.Status = healthOK
+	if err != nil {
+		slog.WarnContext(ctx, "readiness check failed", "check", failMsg, "err", err)
+		check.Status = healthFail
+		check.Error = failMsg
+	}
+	return check
 }
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// lockoutDuration returns how long to lock a key out after the given number of consecutive failures.
+// Nothing is locked below the threshold; from there the lockout doubles with each failure up to LoginLockoutMax.
+func (s *Server) lockoutDuration(failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+
+	d := s.cfg.Auth.LoginLockoutBase
+	for i := threshold; i < failures; i++ {
+		d *= 2
+		if d >= s.cfg.Auth.LoginLockoutMax {
+			return s.cfg.Auth.LoginLockoutMax
+		}
+	}
+	return d
+}
+
+// normalizeEmail lowercases and trims an email so throttles cannot be bypassed by changing case
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginThrottleKeys returns the throttles a login attempt is counted against: the account and the client IP
+func loginThrottleKeys(email, ip string) (account, client store.ThrottleKey) {
+	return store.ThrottleKey{Scope: store.ThrottleScopeAccount, Key: normalizeEmail(email)},
+		store.ThrottleKey{Scope: store.ThrottleScopeIP, Key: ip}
+}
+
+// loginLockedUntil returns the latest lockout expiry that applies to the account or IP, if any
+func (s *Server) loginLockedUntil(ctx context.Context, email, ip string) (time.Time, error) {
+	account, client := loginThrottleKeys(email, ip)
+	return s.throttles.LockedUntil(ctx, account, client)
+}
+
+// loginAllowed writes a 429 response and returns false if the account or client IP is locked out
+func (s *Server) loginAllowed(w http.ResponseWriter, r *http.Request, email, ip string) bool {
+	lockedUntil, err := s.loginLockedUntil(r.Context(), email, ip)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "database error checking login throttle", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return false
+	}
+	if lockedUntil.IsZero() {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(time.Until(lockedUntil).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	apierror.Write(w, r, apierror.TooManyRequests("Too many failed login attempts. Please try again later."))
+	return false
+}
+
+// recordLoginFailure counts a failed login against both the account and the client IP,
+// locking either out once it passes its threshold and writing an audit record when that happens.
+func (s *Server) recordLoginFailure(ctx context.Context, email, ip string) {
+	// Aborting the request must not stop the failure from counting
+	ctx, cancel := s.detach(ctx)
+	defer cancel()
+	account, client := loginThrottleKeys(email, ip)
+
+	throttles := []struct {
+		key       store.ThrottleKey
+		threshold int
+	}{
+		{account, s.cfg.Auth.LoginMaxAccountFailures},
+		{client, s.cfg.Auth.LoginMaxIPFailures},
+	}
+
+	for _, t := range throttles {
+		failures, err := s.throttles.RecordFailure(ctx, t.key, s.cfg.Auth.LoginFailureWindow)
+		if err != nil {
+			slog.ErrorContext(ctx, "error recording failed login", "scope", t.key.Scope, "err", err)
+			continue
+		}
+
+		lockout := s.lockoutDuration(failures, t.threshold)
+		if lockout == 0 {
+			continue
+		}
+
+		lockedUntil := time.Now().Add(lockout)
+		if err := s.throttles.Lock(ctx, t.key, lockedUntil); err != nil {
+			slog.ErrorContext(ctx, "error locking out login", "scope", t.key.Scope, "err", err)
+			continue
+		}
+
+		slog.WarnContext(ctx, "login locked", "scope", t.key.Scope, "failures", failures, "locked_until", lockedUntil)
+		s.recordAuthEvent(ctx, "login_lockout", account.Key, ip, map[string]interface{}{
+			"scope":        t.key.Scope,
+			"failures":     failures,
+			"locked_until": lockedUntil,
+		})
+	}
+}
+
+// clearLoginFailures resets the account throttle after a successful login.
+// The IP throttle is left to expire on its own so one good login cannot reset an attack from that address.
+func (s *Server) clearLoginFailures(ctx context.Context, email string) {
+	account, _ := loginThrottleKeys(email, "")
+	if err := s.throttles.Clear(ctx, account); err != nil {
+		slog.ErrorContext(ctx, "error clearing login failures", "err", err)
+	}
+}
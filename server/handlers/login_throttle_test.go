@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/store/memory"
+)
+
+// attemptLogin sends a login from the given client IP
+func attemptLogin(t *testing.T, s *Server, email, password, ip string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := jsonRequest(t, http.MethodPost, "/api/login", map[string]string{"email": email, "password": password})
+	r.RemoteAddr = ip + ":50000"
+	rec := httptest.NewRecorder()
+	s.LoginHandler(rec, r)
+	return rec
+}
+
+// expectLockedOut fails the test unless rec is a 429 asking the client to wait about lockout
+func expectLockedOut(t *testing.T, rec *httptest.ResponseRecorder, lockout time.Duration) {
+	t.Helper()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d; body %s", rec.Code, http.StatusTooManyRequests, rec.Body)
+	}
+	retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil {
+		t.Fatalf("Retry-After = %q, want a number of seconds", rec.Header().Get("Retry-After"))
+	}
+	if want := int(lockout.Seconds()); retryAfter < want-1 || retryAfter > want {
+		t.Errorf("Retry-After = %d, want %d", retryAfter, want)
+	}
+}
+
+// lockouts returns the login_lockout events in the audit log
+func lockouts(stores store.Stores) []store.AuthEvent {
+	var events []store.AuthEvent
+	for _, e := range stores.Audit.(*memory.AuditStore).Events() {
+		if e.Event == "login_lockout" {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func TestLockoutDuration(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.cfg.Auth.LoginLockoutBase = 30 * time.Second
+	s.cfg.Auth.LoginLockoutMax = 5 * time.Minute
+
+	for _, tt := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{4, 0},
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{8, 4 * time.Minute},
+		{9, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	} {
+		if got := s.lockoutDuration(tt.failures, 5); got != tt.want {
+			t.Errorf("lockoutDuration(%d, 5) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRepeatedLoginFailuresLockOutAccountWithBackoff(t *testing.T) {
+	s, stores := newTestServer(t)
+	signup(t, s, "ada@example.com", models.RoleCustomer)
+	base, threshold := s.cfg.Auth.LoginLockoutBase, s.cfg.Auth.LoginMaxAccountFailures
+	account, _ := loginThrottleKeys("ada@example.com", "")
+
+	// Guesses rotate IPs, so only the account throttle applies
+	ip := 0
+	guess := func(email, password string) *httptest.ResponseRecorder {
+		ip++
+		return attemptLogin(t, s, email, password, "192.0.2."+strconv.Itoa(ip))
+	}
+
+	for i := 1; i <= threshold; i++ {
+		if rec := guess("ada@example.com", "wrong password"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want %d", i, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Locked out even with the right password, and however the address is spelled
+	expectLockedOut(t, guess("ada@example.com", "correct horse"), base)
+	expectLockedOut(t, guess(" ADA@example.com", "correct horse"), base)
+
+	// Each failure after a lockout expires doubles the next one
+	for i, lockout := range []time.Duration{2 * base, 4 * base} {
+		if err := stores.Throttles.Lock(context.Background(), account, time.Now().Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if rec := guess("ada@example.com", "wrong password"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want %d", threshold+i+1, rec.Code, http.StatusUnauthorized)
+		}
+		expectLockedOut(t, guess("ada@example.com", "correct horse"), lockout)
+	}
+
+	events := lockouts(stores)
+	if len(events) != 3 {
+		t.Fatalf("recorded %d lockouts, want 3: %+v", len(events), events)
+	}
+	for i, e := range events {
+		if e.Email != "ada@example.com" || e.Details["scope"] != store.ThrottleScopeAccount || e.Details["failures"] != threshold+i {
+			t.Errorf("lockout %d = %+v, want account lockout of ada@example.com after %d failures", i, e, threshold+i)
+		}
+	}
+}
+
+func TestSuccessfulLoginResetsAccountFailures(t *testing.T) {
+	s, stores := newTestServer(t)
+	signup(t, s, "ada@example.com", models.RoleCustomer)
+	threshold := s.cfg.Auth.LoginMaxAccountFailures
+
+	for round := 0; round < 2; round++ {
+		for i := 1; i < threshold; i++ {
+			attemptLogin(t, s, "ada@example.com", "wrong password", "192.0.2.1")
+		}
+		if rec := attemptLogin(t, s, "ada@example.com", "correct horse", "192.0.2.1"); rec.Code != http.StatusOK {
+			t.Fatalf("round %d: status = %d, want %d; body %s", round, rec.Code, http.StatusOK, rec.Body)
+		}
+	}
+	if events := lockouts(stores); len(events) != 0 {
+		t.Errorf("recorded lockouts %+v, want none", events)
+	}
+}
+
+func TestLoginFailuresFromOneIPLockOutThatIP(t *testing.T) {
+	s, stores := newTestServer(t)
+	signup(t, s, "ada@example.com", models.RoleCustomer)
+	s.cfg.Auth.LoginMaxIPFailures = 3
+
+	// Spraying one password across accounts, known or not, counts against the IP
+	for _, email := range []string{"bob@example.com", "carol@example.com", "dave@example.com"} {
+		if rec := attemptLogin(t, s, email, "password1", "198.51.100.7"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: status = %d, want %d", email, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	expectLockedOut(t, attemptLogin(t, s, "ada@example.com", "correct horse", "198.51.100.7"), s.cfg.Auth.LoginLockoutBase)
+	if rec := attemptLogin(t, s, "ada@example.com", "correct horse", "203.0.113.9"); rec.Code != http.StatusOK {
+		t.Fatalf("other IP: status = %d, want %d; body %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	// A good login elsewhere does not lift the IP lockout
+	expectLockedOut(t, attemptLogin(t, s, "ada@example.com", "correct horse", "198.51.100.7"), s.cfg.Auth.LoginLockoutBase)
+
+	events := lockouts(stores)
+	if len(events) != 1 || events[0].IP != "198.51.100.7" || events[0].Details["scope"] != store.ThrottleScopeIP {
+		t.Errorf("lockouts = %+v, want one lockout of 198.51.100.7", events)
+	}
+}
+
+func TestTwoFactorCodeGuessesCountTowardsLockout(t *testing.T) {
+	s, stores := newTestServer(t)
+	id := userID(signup(t, s, "grace@example.com", models.RoleSeller))
+	secret, _ := enableTwoFactor(t, s, id)
+	base, threshold := s.cfg.Auth.LoginLockoutBase, s.cfg.Auth.LoginMaxAccountFailures
+	account, _ := loginThrottleKeys("grace@example.com", "")
+
+	challenge := func() string {
+		t.Helper()
+		r := jsonRequest(t, http.MethodPost, "/api/login", map[string]string{"email": "grace@example.com", "password": "correct horse"})
+		r.RemoteAddr = "192.0.2.1:50000"
+		return serve(t, s.LoginHandler, r, http.StatusOK)["challenge_token"].(string)
+	}
+	verify := func(challenge, code string) *httptest.ResponseRecorder {
+		r := jsonRequest(t, http.MethodPost, "/api/auth/2fa", map[string]string{"challenge_token": challenge, "code": code})
+		r.RemoteAddr = "192.0.2.1:50000"
+		rec := httptest.NewRecorder()
+		s.VerifyTwoFactorHandler(rec, r)
+		return rec
+	}
+
+	// Logging in again with the password does not reset the wrong codes already sent
+	first := challenge()
+	for i := 1; i < threshold; i++ {
+		if rec := verify(first, "000000"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: status = %d, want %d", i, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	second := challenge()
+	if rec := verify(second, "000000"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("guess %d: status = %d, want %d", threshold, rec.Code, http.StatusUnauthorized)
+	}
+
+	// Locked out of both steps, even with the right code, which is refused before it is checked
+	step := time.Now().Unix() / 30
+	expectLockedOut(t, verify(second, totpCode(t, secret, step+1)), base)
+	expectLockedOut(t, attemptLogin(t, s, "grace@example.com", "correct horse", "192.0.2.1"), base)
+
+	// One more wrong code after the lockout expires doubles it
+	if err := stores.Throttles.Lock(context.Background(), account, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if rec := verify(challenge(), "000000"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("guess %d: status = %d, want %d", threshold+1, rec.Code, http.StatusUnauthorized)
+	}
+	expectLockedOut(t, attemptLogin(t, s, "grace@example.com", "correct horse", "192.0.2.1"), 2*base)
+
+	// Only passing the second factor clears the failures
+	if err := stores.Throttles.Lock(context.Background(), account, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if rec := verify(challenge(), totpCode(t, secret, step+1)); rec.Code != http.StatusOK {
+		t.Fatalf("verify: status = %d, want %d; body %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if rec := verify(challenge(), "000000"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("guess after success: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	challenge()
+}
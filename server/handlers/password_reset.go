@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/utils"
+)
+
+// ForgotPasswordHandler emails a single-use password reset link.
+// It responds the same way whether or not the email is registered so accounts cannot be enumerated.
+func (s *Server) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || strings.TrimSpace(input.Email) == "" {
+		apierror.Write(w, r, apierror.BadRequest("Email is required"))
+		return
+	}
+
+	response := map[string]string{"message": "If that email is registered, a reset link has been sent"}
+
+	user, err := s.users.GetUserByEmail(r.Context(), input.Email)
+	if errors.Is(err, store.ErrNotFound) {
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "database error looking up user for password reset", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+	userID, email := user.ID, user.Email
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating reset token", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	// Only the most recent reset link may be used
+	err = s.passwordResets.CreatePasswordReset(r.Context(), userID, tokenHash, time.Now().Add(s.cfg.Auth.PasswordResetTTL))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error storing reset token", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	body := fmt.Sprintf(
+		"We received a request to reset your password.\n\nReset it here: %s?token=%s\n\nThis link expires in %s. If you did not ask for a reset you can ignore this email.",
+		s.cfg.PasswordResetURL(), token, s.cfg.Auth.PasswordResetTTL,
+	)
+	// A failed send must not answer differently from an unknown email
+	if err := s.mail.Send(email, "Reset your password", body); err != nil {
+		slog.ErrorContext(r.Context(), "error sending reset email", "user_id", userID, "err", err)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "password reset requested", "user_id", userID)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ResetPasswordHandler sets a new password using a reset token and signs the user out everywhere
+func (s *Server) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
+		return
+	}
+
+	if input.Token == "" {
+		apierror.Write(w, r, apierror.BadRequest("Token is required"))
+		return
+	}
+
+	if err := models.ValidatePassword("password", input.Password, s.cfg.Auth.MinPasswordLength); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error hashing password", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error processing password"))
+		return
+	}
+
+	// The token is single-use; resetting also signs the user out of every existing session
+	userID, err := s.passwordResets.ResetPassword(r.Context(), utils.HashToken(input.Token), string(hashedPassword))
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.BadRequest("Reset link is invalid or has expired"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error resetting password", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "password reset", "user_id", userID)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset. Please log in again."})
+}
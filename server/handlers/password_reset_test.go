@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/rythmokay/golang/server/models"
+)
+
+// resetPassword sets a new password through ResetPasswordHandler
+func resetPassword(t *testing.T, s *Server, token, password string, want int) {
+	t.Helper()
+	serve(t, s.ResetPasswordHandler, jsonRequest(t, http.MethodPost, "/api/auth/reset-password", map[string]string{
+		"token": token, "password": password,
+	}), want)
+}
+
+func TestPasswordResetIsSingleUseAndEndsSessions(t *testing.T) {
+	s, _ := newTestServer(t)
+	mail := captureMail(s)
+	session := signup(t, s, "ada@example.com", models.RoleCustomer)["refresh_token"].(string)
+
+	serve(t, s.ForgotPasswordHandler, jsonRequest(t, http.MethodPost, "/api/auth/forgot-password", map[string]string{
+		"email": "ada@example.com",
+	}), http.StatusOK)
+	token := mail.lastToken(t, "ada@example.com")
+
+	resetPassword(t, s, token, "battery staple", http.StatusOK)
+	resetPassword(t, s, token, "another password", http.StatusBadRequest)
+
+	login(t, s, "ada@example.com", "correct horse", http.StatusUnauthorized)
+	login(t, s, "ada@example.com", "battery staple", http.StatusOK)
+	refresh(t, s, session, http.StatusUnauthorized)
+}
+
+func TestPasswordResetOnlyAcceptsLatestLink(t *testing.T) {
+	s, _ := newTestServer(t)
+	mail := captureMail(s)
+	signup(t, s, "ada@example.com", models.RoleCustomer)
+
+	forgot := func() string {
+		serve(t, s.ForgotPasswordHandler, jsonRequest(t, http.MethodPost, "/api/auth/forgot-password", map[string]string{
+			"email": "ada@example.com",
+		}), http.StatusOK)
+		return mail.lastToken(t, "ada@example.com")
+	}
+	older, newer := forgot(), forgot()
+
+	resetPassword(t, s, older, "battery staple", http.StatusBadRequest)
+	resetPassword(t, s, newer, "battery staple", http.StatusOK)
+}
+
+func TestForgotPasswordDoesNotRevealUnknownEmails(t *testing.T) {
+	s, _ := newTestServer(t)
+	mail := captureMail(s)
+
+	serve(t, s.ForgotPasswordHandler, jsonRequest(t, http.MethodPost, "/api/auth/forgot-password", map[string]string{
+		"email": "nobody@example.com",
+	}), http.StatusOK)
+	if len(mail.sent) != 0 {
+		t.Errorf("sent %d emails for an unknown address", len(mail.sent))
+	}
+}
+
+// failingSender is a mail server that is down
+type failingSender struct{}
+
+func (failingSender) Send(to, subject, body string) error {
+	return errors.New("connection refused")
+}
+
+func TestForgotPasswordHidesSendFailures(t *testing.T) {
+	s, _ := newTestServer(t)
+	signup(t, s, "ada@example.com", models.RoleCustomer)
+	s.mail = failingSender{}
+
+	forgot := func(email string) map[string]interface{} {
+		return serve(t, s.ForgotPasswordHandler, jsonRequest(t, http.MethodPost, "/api/auth/forgot-password", map[string]string{
+			"email": email,
+		}), http.StatusOK)
+	}
+	if registered, unknown := forgot("ada@example.com"), forgot("nobody@example.com"); !reflect.DeepEqual(registered, unknown) {
+		t.Errorf("response for a failed send = %v, want the unknown email response %v", registered, unknown)
+	}
+}
@@ -1,34 +1,50 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/rythmokay/golang/server/database"
+	"github.com/rythmokay/golang/server/apierror"
 	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
 )
 
 // CreateProductHandler handles the creation of a new product
-func CreateProductHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) CreateProductHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Only sellers with a verified email may list products
+	if !s.requireVerifiedEmail(w, r, principal.UserID) {
 		return
 	}
 
 	// Parse the product data from request body
 	var product models.Product
 	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
-		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
 		return
 	}
 
-	// Validate required fields
-	if product.Name == "" || product.Price <= 0 || product.Category == "" {
-		http.Error(w, "Name, price, and category are required", http.StatusBadRequest)
+	// Products always belong to the authenticated seller
+	product.SellerID = principal.UserID
+
+	if err := product.Validate(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if !s.resolveProductCategory(w, r, &product) {
 		return
 	}
 
@@ -37,28 +53,14 @@ func CreateProductHandler(w http.ResponseWriter, r *http.Request) {
 	product.CreatedAt = now
 	product.UpdatedAt = now
 
-	// Insert the product into database
-	query := `
-		INSERT INTO products (seller_id, name, description, price, stock, category, image_url, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id`
-
-	err := database.DB.QueryRow(
-		query,
-		product.SellerID,
-		product.Name,
-		product.Description,
-		product.Price,
-		product.Stock,
-		product.Category,
-		product.ImageURL,
-		product.CreatedAt,
-		product.UpdatedAt,
-	).Scan(&product.ID)
-
+	err := s.products.CreateProduct(r.Context(), &product)
+	if errors.Is(err, store.ErrInvalid) {
+		apierror.Write(w, r, apierror.From(err).WithMessage("Product contains invalid values"))
+		return
+	}
 	if err != nil {
-		log.Printf("Error creating product: %v", err)
-		http.Error(w, "Error creating product", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error creating product", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error creating product"))
 		return
 	}
 
@@ -69,81 +71,22 @@ func CreateProductHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetSellerProductsHandler handles fetching all products for a seller
-func GetSellerProductsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("🔍 Received request to get seller products")
+func (s *Server) GetSellerProductsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Check for authentication token
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		log.Printf("❌ Missing authorization header")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Authentication required"})
+		apierror.Write(w, r, apierror.MethodNotAllowed())
 		return
 	}
 
-	// Get seller ID from query parameter
-	sellerIDStr := r.URL.Query().Get("seller_id")
-	if sellerIDStr == "" {
-		log.Printf("❌ Missing seller_id parameter")
-		http.Error(w, "Seller ID is required", http.StatusBadRequest)
+	// Sellers can only list their own products
+	principal, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
-	sellerID, err := strconv.Atoi(sellerIDStr)
+	products, err := s.products.ListSellerProducts(r.Context(), principal.UserID)
 	if err != nil {
-		log.Printf("❌ Invalid seller ID format: %s", sellerIDStr)
-		http.Error(w, "Invalid seller ID", http.StatusBadRequest)
-		return
-	}
-	
-	// In a real application, you would verify the token and check if the user
-	// has the seller role and is authorized to access these products
-	// For now, we'll just log the request
-
-	// Query products from database
-	query := `
-		SELECT id, seller_id, name, description, price, stock, category, image_url, created_at, updated_at
-		FROM products
-		WHERE seller_id = $1
-		ORDER BY created_at DESC`
-
-	rows, err := database.DB.Query(query, sellerID)
-	if err != nil {
-		log.Printf("Error querying products: %v", err)
-		http.Error(w, "Error fetching products", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	var products []models.Product
-	for rows.Next() {
-		var p models.Product
-		err := rows.Scan(
-			&p.ID,
-			&p.SellerID,
-			&p.Name,
-			&p.Description,
-			&p.Price,
-			&p.Stock,
-			&p.Category,
-			&p.ImageURL,
-			&p.CreatedAt,
-			&p.UpdatedAt,
-		)
-		if err != nil {
-			log.Printf("Error scanning product: %v", err)
-			continue
-		}
-		products = append(products, p)
-	}
-
-	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating products: %v", err)
-		http.Error(w, "Error fetching products", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error querying products", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error fetching products"))
 		return
 	}
 
@@ -153,52 +96,55 @@ func GetSellerProductsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateProductHandler handles updating a product
-func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
 	// Parse the product data from request body
 	var product models.Product
 	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
-		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
+		return
+	}
+
+	if product.ID == 0 {
+		apierror.Write(w, r, apierror.BadRequest("Product ID is required"))
+		return
+	}
+	if err := product.Validate(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if !s.resolveProductCategory(w, r, &product) {
 		return
 	}
 
-	// Validate required fields
-	if product.ID == 0 || product.Name == "" || product.Price <= 0 || product.Category == "" {
-		http.Error(w, "ID, name, price, and category are required", http.StatusBadRequest)
+	// Make sure the product belongs to the authenticated seller
+	product.SellerID = principal.UserID
+	if !s.authorizeProductOwner(w, r, product.ID, principal.UserID) {
 		return
 	}
 
-	// Update the product in database
-	query := `
-		UPDATE products
-		SET name = $1, description = $2, price = $3, stock = $4, category = $5, image_url = $6, updated_at = $7
-		WHERE id = $8 AND seller_id = $9
-		RETURNING id`
-
-	err := database.DB.QueryRow(
-		query,
-		product.Name,
-		product.Description,
-		product.Price,
-		product.Stock,
-		product.Category,
-		product.ImageURL,
-		time.Now(),
-		product.ID,
-		product.SellerID,
-	).Scan(&product.ID)
-
-	if err == sql.ErrNoRows {
-		http.Error(w, "Product not found or unauthorized", http.StatusNotFound)
+	product.UpdatedAt = time.Now()
+	err := s.products.UpdateProduct(r.Context(), &product)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Product not found or unauthorized"))
+		return
+	}
+	if errors.Is(err, store.ErrInvalid) {
+		apierror.Write(w, r, apierror.From(err).WithMessage("Product contains invalid values"))
 		return
 	}
 	if err != nil {
-		log.Printf("Error updating product: %v", err)
-		http.Error(w, "Error updating product", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error updating product", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error updating product"))
 		return
 	}
 
@@ -208,51 +154,44 @@ func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // DeleteProductHandler handles deleting a product
-func DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, apierror.MethodNotAllowed())
 		return
 	}
 
-	// Get product ID and seller ID from query parameters
-	productIDStr := r.URL.Query().Get("product_id")
-	sellerIDStr := r.URL.Query().Get("seller_id")
-
-	if productIDStr == "" || sellerIDStr == "" {
-		http.Error(w, "Product ID and seller ID are required", http.StatusBadRequest)
+	principal, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
-	productID, err := strconv.Atoi(productIDStr)
-	if err != nil {
-		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+	// Get product ID from query parameters
+	productIDStr := r.URL.Query().Get("product_id")
+	if productIDStr == "" {
+		apierror.Write(w, r, apierror.BadRequest("Product ID is required"))
 		return
 	}
 
-	sellerID, err := strconv.Atoi(sellerIDStr)
+	productID, err := strconv.Atoi(productIDStr)
 	if err != nil {
-		http.Error(w, "Invalid seller ID", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid product ID"))
 		return
 	}
 
-	// Delete the product from database
-	query := "DELETE FROM products WHERE id = $1 AND seller_id = $2"
-	result, err := database.DB.Exec(query, productID, sellerID)
-	if err != nil {
-		log.Printf("Error deleting product: %v", err)
-		http.Error(w, "Error deleting product", http.StatusInternalServerError)
+	// Make sure the product belongs to the authenticated seller
+	sellerID := principal.UserID
+	if !s.authorizeProductOwner(w, r, productID, sellerID) {
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Error deleting product", http.StatusInternalServerError)
+	err = s.products.DeleteProduct(r.Context(), productID, sellerID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Product not found or unauthorized"))
 		return
 	}
-
-	if rowsAffected == 0 {
-		http.Error(w, "Product not found or unauthorized", http.StatusNotFound)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error deleting product", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error deleting product"))
 		return
 	}
 
@@ -260,3 +199,52 @@ func DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Product deleted successfully"})
 }
+
+// authorizeProductOwner checks that productID exists and is owned by sellerID.
+// It writes a 404 or 403 response and returns false otherwise.
+func (s *Server) authorizeProductOwner(w http.ResponseWriter, r *http.Request, productID, sellerID int) bool {
+	product, err := s.products.GetProduct(r.Context(), productID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Product not found"))
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error checking product owner", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return false
+	}
+	if product.SellerID != sellerID {
+		slog.WarnContext(r.Context(), "attempt to modify another seller's product", "product_id", productID, "owner_id", product.SellerID)
+		apierror.Write(w, r, apierror.Forbidden("You do not have permission to modify this product"))
+		return false
+	}
+	return true
+}
+
+// resolveProductCategory points a product at an existing category. Clients that predate the category tree
+// send the category name instead of category_id; it is matched by slug, so "Electronics" and "electronics "
+// find the same category. It writes a 422 response and returns false when there is no such category.
+func (s *Server) resolveProductCategory(w http.ResponseWriter, r *http.Request, product *models.Product) bool {
+	field := "category_id"
+	var category models.Category
+	var err error
+	if product.CategoryID != 0 {
+		category, err = s.categories.GetCategory(r.Context(), product.CategoryID)
+	} else {
+		field = "category"
+		category, err = s.categories.GetCategoryBySlug(r.Context(), models.Slugify(product.Category))
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.Validation("Request validation failed",
+			apierror.FieldError{Field: field, Message: "must be an existing category"}))
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error looking up product category", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error looking up category"))
+		return false
+	}
+
+	product.CategoryID, product.Category = category.ID, category.Name
+	return true
+}
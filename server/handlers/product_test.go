@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/rythmokay/golang/server/models"
+)
+
+func TestDeleteProductInCartConflicts(t *testing.T) {
+	s, stores := newTestServer(t)
+	sellerID := userID(signup(t, s, "grace@example.com", models.RoleSeller))
+	customerID := userID(signup(t, s, "ada@example.com", models.RoleCustomer))
+	lamp := createProduct(t, stores, sellerID, "Brass lamp")
+	if err := stores.Carts.AddCartItem(context.Background(), customerID, lamp.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/products/delete?product_id="+strconv.Itoa(lamp.ID), nil)
+	body := serve(t, s.DeleteProductHandler, asUser(r, sellerID, models.RoleSeller), http.StatusConflict)
+	if code := body["error"].(map[string]interface{})["code"]; code != "conflict" {
+		t.Errorf("code = %v, want conflict", code)
+	}
+}
@@ -2,60 +2,42 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
-	"strconv"
+	"strings"
 
-	"github.com/rythmokay/golang/server/database"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/rythmokay/golang/server/apierror"
 	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
 )
 
 // GetProfile handles fetching user profile information
-func GetProfile(w http.ResponseWriter, r *http.Request) {
-	log.Printf("📝 Received profile fetch request")
+func (s *Server) GetProfile(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method != http.MethodGet {
-		log.Printf("❌ Method not allowed: %s", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, apierror.MethodNotAllowed())
 		return
 	}
 
-	// Get user ID from query parameter
-	userIDStr := r.URL.Query().Get("user_id")
-	log.Printf("📝 Fetching profile for user ID: %s", userIDStr)
-
-	if userIDStr == "" {
-		log.Printf("❌ User ID is required")
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+	// Profiles are only ever returned for the authenticated user
+	principal, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
+	userID := principal.UserID
 
-	userID, err := strconv.Atoi(userIDStr)
+	user, err := s.users.GetUserByID(r.Context(), userID)
 	if err != nil {
-		log.Printf("❌ Invalid user ID: %v", err)
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "error fetching user profile", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error fetching profile"))
 		return
 	}
-
-	// Query user from database
-	var user models.User
-	query := `
-		SELECT id, name, email, role, COALESCE(address, '') as address, COALESCE(phone_number, '') as phone_number
-		FROM users
-		WHERE id = $1
-	`
-	log.Printf("📝 Executing query: %s with ID: %d", query, userID)
-
-	err = database.DB.QueryRow(query, userID).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Address, &user.PhoneNumber)
-
-	if err != nil {
-		log.Printf("❌ Error fetching user profile: %v", err)
-		http.Error(w, "Error fetching profile", http.StatusInternalServerError)
-		return
-	}
-
-	log.Printf("✅ Successfully fetched profile for user ID: %d", userID)
+	// Never send the password hash back
+	user.Password = ""
 
 	// Return user profile
 	w.Header().Set("Content-Type", "application/json")
@@ -63,29 +45,45 @@ func GetProfile(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateProfile handles updating user profile information
-func UpdateProfile(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
 	// Parse the user data from request body
 	var user models.User
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
 		return
 	}
 
-	// Update user in database - only update name, address, and phone number (not email)
-	_, err := database.DB.Exec(`
-		UPDATE users
-		SET name = $1, address = $2, phone_number = $3
-		WHERE id = $4
-	`, user.Name, user.Address, user.PhoneNumber, user.ID)
+	// The body's id is ignored; users may only update their own profile
+	user.ID = principal.UserID
+
+	if err := user.ValidateProfile(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
+	// Only name, address and phone number can be changed here (not email)
+	err := s.users.UpdateProfile(r.Context(), user.ID, user.Name, user.Address, user.PhoneNumber)
+	if errors.Is(err, store.ErrInvalid) {
+		apierror.Write(w, r, apierror.From(err).WithMessage("Profile contains invalid values"))
+		return
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("User not found"))
+		return
+	}
 	if err != nil {
-		log.Printf("Error updating user profile: %v", err)
-		http.Error(w, "Error updating profile", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error updating user profile", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error updating profile"))
 		return
 	}
 
@@ -93,3 +91,148 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Profile updated successfully"})
 }
+
+// checkCurrentPassword verifies the user's current password before a sensitive change.
+// It writes an error response and returns false if the password is missing or wrong.
+func (s *Server) checkCurrentPassword(w http.ResponseWriter, r *http.Request, userID int, password string) bool {
+	if password == "" {
+		apierror.Write(w, r, apierror.BadRequest("Current password is required"))
+		return false
+	}
+
+	user, err := s.users.GetUserByID(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("User not found"))
+		return false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error fetching password", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		apierror.Write(w, r, apierror.Forbidden("Current password is incorrect"))
+		return false
+	}
+	return true
+}
+
+// ChangePasswordHandler changes the authenticated user's password and signs out their other sessions
+func (s *Server) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
+		return
+	}
+
+	if err := models.ValidatePassword("new_password", input.NewPassword, s.cfg.Auth.MinPasswordLength); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if !s.checkCurrentPassword(w, r, principal.UserID, input.CurrentPassword) {
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error hashing password", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error processing password"))
+		return
+	}
+
+	// Keep the session making this request, revoke every other one
+	if err := s.users.SetPassword(r.Context(), principal.UserID, string(hashedPassword), principal.SessionID); err != nil {
+		slog.ErrorContext(r.Context(), "error updating password", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error updating password"))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "password changed")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed successfully"})
+}
+
+// ChangeEmailHandler starts an email change for the authenticated user.
+// The new address only replaces the current one after it is confirmed through VerifyEmailHandler.
+func (s *Server) ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		NewEmail        string `json:"new_email"`
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
+		return
+	}
+
+	input.NewEmail = strings.TrimSpace(input.NewEmail)
+	if err := models.ValidateEmail("new_email", input.NewEmail); err != nil {
+		invalid := apierror.BadRequest("Invalid email address")
+		invalid.Details = apierror.From(err).Details
+		apierror.Write(w, r, invalid)
+		return
+	}
+
+	if !s.checkCurrentPassword(w, r, principal.UserID, input.CurrentPassword) {
+		return
+	}
+
+	// Check the address is not already in use (idx_users_email also enforces this on verification)
+	existing, err := s.users.GetUserByEmail(r.Context(), input.NewEmail)
+	if err == nil {
+		if existing.ID == principal.UserID {
+			apierror.Write(w, r, apierror.BadRequest("That is already your email address"))
+		} else {
+			apierror.Write(w, r, apierror.Conflict("Email already registered"))
+		}
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		slog.ErrorContext(r.Context(), "database error checking email", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	// Only the latest requested address can be confirmed
+	if err := s.verifications.RetireEmailVerifications(r.Context(), principal.UserID); err != nil {
+		slog.ErrorContext(r.Context(), "error retiring verification tokens", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	if err := s.sendVerificationEmail(r.Context(), principal.UserID, input.NewEmail); err != nil {
+		slog.ErrorContext(r.Context(), "error sending verification email", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Could not send verification email"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Check your new email address for a link to confirm the change",
+	})
+}
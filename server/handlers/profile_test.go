@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/models"
+)
+
+func TestChangeEmailRejectsAddressesSignupWouldRefuse(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+	}{
+		{"missing", "  "},
+		{"malformed", "not-an-email"},
+		{"too long", strings.Repeat("a", 95) + "@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			body, _ := json.Marshal(map[string]string{"new_email": tt.email, "current_password": "secret123"})
+			req := asUser(httptest.NewRequest(http.MethodPut, "/api/profile/email", bytes.NewReader(body)), 1, models.RoleCustomer)
+			rec := httptest.NewRecorder()
+			s.ChangeEmailHandler(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+			var got struct {
+				Error apierror.Error `json:"error"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if details := got.Error.Details; len(details) != 1 || details[0].Field != "new_email" {
+				t.Errorf("details = %+v, want one error for new_email", details)
+			}
+		})
+	}
+}
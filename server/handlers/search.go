@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/validate"
+)
+
+// Search limits. Relevance-ordered results are paged by offset, so deep pages are capped.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+	maxSearchOffset    = 1000
+	maxSearchLength    = 200
+)
+
+// Suggestion limits. Trigram indexes only narrow the lookup from three characters on,
+// so single characters are refused.
+const (
+	minSuggestLength    = 2
+	maxSuggestLength    = 100
+	defaultSuggestLimit = 5
+	maxSuggestLimit     = 10
+)
+
+// Search miss limits. Shorter queries are mostly half-typed words and are not recorded.
+// Recording a miss gets a small budget of its own; a slow write drops the count rather than the search.
+const (
+	minSearchMissLength    = 3
+	searchMissTimeout      = 100 * time.Millisecond
+	defaultSearchMissDays  = 30
+	maxSearchMissDays      = 365
+	defaultSearchMissLimit = 20
+	maxSearchMissLimit     = 100
+)
+
+// SearchProductsHandler searches the catalog by name, category and description, best match first.
+//
+// Query parameters:
+//   - q: the search text (required); each word matches as a prefix, so partial words work
+//   - category: one or more categories, repeated or comma-separated
+//   - in_stock=true: only products with stock left
+//   - limit: page size, 1 to 50 (default 20)
+//   - offset: number of results to skip, up to 1000
+//
+// When no product contains the words, products with similar names are returned and "fuzzy" is true.
+// name_highlight and snippet are HTML with the matched words wrapped in <mark>.
+func (s *Server) SearchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	query, err := parseSearchQuery(r.URL.Query())
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	page, err := s.products.SearchProducts(r.Context(), query)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error searching products", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Failed to search products"))
+		return
+	}
+
+	if page.Total == 0 && query.Offset == 0 {
+		s.recordSearchMiss(r.Context(), query.Text)
+	}
+
+	// Always return an array, even if empty
+	if page.Results == nil {
+		page.Results = make([]models.ProductSearchResult, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"query":    query.Text,
+		"products": page.Results,
+		"total":    page.Total,
+		"fuzzy":    page.Fuzzy,
+		"limit":    query.Limit,
+		"offset":   query.Offset,
+	})
+	slog.DebugContext(r.Context(), "search completed", "results", len(page.Results), "total", page.Total, "fuzzy", page.Fuzzy)
+}
+
+// parseSearchQuery reads the search text, filters and page from the query string
+func parseSearchQuery(params url.Values) (store.SearchQuery, error) {
+	q := store.SearchQuery{
+		Text:  strings.TrimSpace(params.Get("q")),
+		Limit: defaultSearchLimit,
+	}
+	var errs [][]validate.FieldError
+
+	q.Categories = categoryParam(params)
+	errs = append(errs,
+		boolParam(params, "in_stock", &q.InStock),
+		numberParam(params, "limit", &q.Limit),
+		numberParam(params, "offset", &q.Offset),
+	)
+
+	// Queries made only of punctuation have nothing to search for
+	hasTerms := func(text string) string {
+		if text != "" && len(store.SearchTerms(text)) == 0 {
+			return "must contain letters or digits"
+		}
+		return ""
+	}
+	errs = append(errs,
+		validate.Field("q", q.Text, validate.Required, validate.MaxLength(maxSearchLength), hasTerms),
+		validate.Field("limit", q.Limit, validate.Positive[int], validate.AtMost(maxSearchLimit)),
+		validate.Field("offset", q.Offset, validate.NonNegative[int], validate.AtMost(maxSearchOffset)),
+	)
+	return q, validate.Check(errs...)
+}
+
+// SuggestHandler completes the storefront search box with product names, categories and sellers
+// containing the typed text.
+//
+// Query parameters:
+//   - q: the text typed so far, at least 2 characters (required)
+//   - limit: suggestions per kind, 1 to 10 (default 5)
+//
+// Lookups slower than the configured budget return no suggestions rather than holding up typing.
+func (s *Server) SuggestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	params := r.URL.Query()
+	text := strings.TrimSpace(params.Get("q"))
+	limit := defaultSuggestLimit
+	if err := validate.Check(
+		numberParam(params, "limit", &limit),
+		validate.Field("q", text, validate.Required, validate.MinLength(minSuggestLength), validate.MaxLength(maxSuggestLength)),
+		validate.Field("limit", limit, validate.Positive[int], validate.AtMost(maxSuggestLimit)),
+	); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.Search.SuggestTimeout)
+	defer cancel()
+	suggestions, err := s.products.Suggest(ctx, text, limit)
+	// Checking ctx rather than err also catches queries Postgres cancelled, which fail with SQLSTATE 57014
+	if err != nil && ctx.Err() != nil {
+		slog.WarnContext(r.Context(), "suggestions exceeded their latency budget", "budget", s.cfg.Search.SuggestTimeout.String())
+		suggestions = models.Suggestions{
+			Products:   []models.ProductSuggestion{},
+			Categories: []models.CategorySuggestion{},
+			Sellers:    []models.SellerSuggestion{},
+		}
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "error fetching suggestions", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Failed to fetch suggestions"))
+		return
+	}
+
+	// The same prefix is typed by many customers; let browsers reuse answers briefly
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"query":       text,
+		"suggestions": suggestions,
+	})
+}
+
+// recordSearchMiss logs a query that found nothing and counts it for sellers, after normalizing it the way
+// search does. Only the full search records misses; typeahead prefixes that find nothing are not what customers
+// were looking for. The write is bounded by searchMissTimeout, so the customer waits at most that long for it.
+func (s *Server) recordSearchMiss(ctx context.Context, text string) {
+	query := strings.Join(store.SearchTerms(text), " ")
+	if utf8.RuneCountInString(query) < minSearchMissLength {
+		return
+	}
+	if runes := []rune(query); len(runes) > maxSearchLength {
+		query = string(runes[:maxSearchLength])
+	}
+	slog.InfoContext(ctx, "search found nothing", "query", query)
+
+	ctx, cancel := context.WithTimeout(ctx, searchMissTimeout)
+	defer cancel()
+	if err := s.products.RecordSearchMiss(ctx, query); err != nil {
+		slog.WarnContext(ctx, "error recording search miss", "err", err)
+	}
+}
+
+// GetSearchMissesHandler shows sellers what customers searched for without finding anything.
+//
+// Query parameters:
+//   - days: how far back to look, 1 to 365 (default 30)
+//   - limit: number of queries, 1 to 100 (default 20)
+func (s *Server) GetSearchMissesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	params := r.URL.Query()
+	days, limit := defaultSearchMissDays, defaultSearchMissLimit
+	if err := validate.Check(
+		numberParam(params, "days", &days),
+		numberParam(params, "limit", &limit),
+		validate.Field("days", days, validate.Positive[int], validate.AtMost(maxSearchMissDays)),
+		validate.Field("limit", limit, validate.Positive[int], validate.AtMost(maxSearchMissLimit)),
+	); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	misses, err := s.products.ListSearchMisses(r.Context(), since, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error fetching search misses", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Failed to fetch search misses"))
+		return
+	}
+	if misses == nil {
+		misses = make([]models.SearchMiss, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"days":    days,
+		"misses":  misses,
+	})
+}
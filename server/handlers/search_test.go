@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// slowSuggestStore answers Suggest the way lib/pq does when the context ends mid-query
+type slowSuggestStore struct {
+	store.ProductStore
+}
+
+func (slowSuggestStore) Suggest(ctx context.Context, text string, limit int) (models.Suggestions, error) {
+	<-ctx.Done()
+	return models.Suggestions{}, &pq.Error{Code: "57014", Message: "canceling statement due to user request"}
+}
+
+func TestSuggestOverBudgetReturnsNoSuggestions(t *testing.T) {
+	s, stores := newTestServer(t)
+	s.cfg.Search.SuggestTimeout = 10 * time.Millisecond
+	s.products = slowSuggestStore{stores.Products}
+
+	rec := httptest.NewRecorder()
+	s.SuggestHandler(rec, httptest.NewRequest(http.MethodGet, "/api/shop/suggest?q=phone", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var body struct {
+		Suggestions models.Suggestions `json:"suggestions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Suggestions.Products == nil || len(body.Suggestions.Products) != 0 {
+		t.Errorf("products = %v, want an empty list", body.Suggestions.Products)
+	}
+}
+
+func TestSearchMissesComeOnlyFromFullSearch(t *testing.T) {
+	s, stores := newTestServer(t)
+
+	for _, target := range []string{
+		"/api/shop/suggest?q=unicorn",
+		"/api/shop/suggest?q=unicor",
+		"/api/shop/search?q=unicorn",
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if strings.Contains(target, "suggest") {
+			s.SuggestHandler(rec, req)
+		} else {
+			s.SearchProductsHandler(rec, req)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d; body %s", target, rec.Code, http.StatusOK, rec.Body)
+		}
+	}
+
+	// The write is synchronous, so the miss is visible as soon as the search returns
+	misses, err := stores.Products.ListSearchMisses(context.Background(), time.Now().AddDate(0, 0, -1), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(misses) != 1 || misses[0].Query != "unicorn" || misses[0].Searches != 1 {
+		t.Errorf("misses = %+v, want one search for %q", misses, "unicorn")
+	}
+}
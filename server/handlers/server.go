@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rythmokay/golang/server/config"
+	"github.com/rythmokay/golang/server/mailer"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/utils"
+)
+
+// Server holds the configuration, stores and services shared by the HTTP handlers
+type Server struct {
+	cfg        *config.Config
+	auth       *utils.Authenticator
+	users      store.UserStore
+	products   store.ProductStore
+	categories store.CategoryStore
+	carts      store.CartStore
+	orders     store.OrderStore
+
+	sessions       store.SessionStore
+	passwordResets store.PasswordResetStore
+	verifications  store.VerificationStore
+	twoFactor      store.TwoFactorStore
+	throttles      store.ThrottleStore
+	audit          store.AuditStore
+
+	mail mailer.Sender
+
+	// db is only used by the readiness checks, which report on the connection pool and migrations themselves
+	db *sql.DB
+}
+
+// NewServer returns a Server whose handlers use cfg, issue tokens with auth, keep data in stores and send email with mail
+func NewServer(cfg *config.Config, auth *utils.Authenticator, stores store.Stores, mail mailer.Sender, db *sql.DB) *Server {
+	return &Server{
+		cfg:        cfg,
+		auth:       auth,
+		users:      stores.Users,
+		products:   stores.Products,
+		categories: stores.Categories,
+		carts:      stores.Carts,
+		orders:     stores.Orders,
+
+		sessions:       stores.Sessions,
+		passwordResets: stores.PasswordResets,
+		verifications:  stores.Verifications,
+		twoFactor:      stores.TwoFactor,
+		throttles:      stores.Throttles,
+		audit:          stores.Audit,
+
+		mail: mail,
+
+		db: db,
+	}
+}
+
+// detach returns a context that keeps ctx's values but is not cancelled with it, bounded by the query timeout.
+// It is used for security records that must be written even when the client hangs up mid-request.
+func (s *Server) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), s.cfg.Database.QueryTimeout)
+}
@@ -1,338 +1,426 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
-	"github.com/rythmokay/golang/server/database"
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/metrics"
 	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/validate"
 )
 
-// GetAllProductsHandler returns all available products for the shop, with optional category filter
-func GetAllProductsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("GetAllProductsHandler called with method: %s from %s", r.Method, r.RemoteAddr)
-
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "*")
-
-	// Handle preflight request
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
+// Catalog page sizes
+const (
+	defaultCatalogLimit = 24
+	maxCatalogLimit     = 100
+)
 
+// GetAllProductsHandler returns one page of the shop catalog.
+//
+// Query parameters, all optional:
+//   - category: one or more categories, repeated or comma-separated ("all" means no filter)
+//   - min_price, max_price: price range, inclusive
+//   - in_stock=true: only products with stock left
+//   - seller_id: only products of one seller
+//   - sort: newest (default), price_asc, price_desc, name or popular
+//   - limit: page size, 1 to 100 (default 24)
+//   - cursor: next_cursor from the previous page
+func (s *Server) GetAllProductsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, apierror.MethodNotAllowed())
 		return
 	}
 
-	// Check if category filter is provided
-	category := r.URL.Query().Get("category")
-	
-	var rows *sql.Rows
-	var err error
-	
-	// Get products with optional category filter
-	log.Println("Querying database for products...")
-	
-	if category != "" && category != "all" {
-		log.Printf("Filtering by category: %s", category)
-		rows, err = database.DB.Query(`
-			SELECT 
-				p.id, 
-				p.name, 
-				p.description, 
-				p.price, 
-				p.stock, 
-				p.category, 
-				p.image_url, 
-				COALESCE(u.name, 'Unknown Seller') as seller_name
-			FROM products p
-			LEFT JOIN users u ON p.seller_id = u.id
-			WHERE p.category = $1
-			ORDER BY p.created_at DESC
-		`, category)
-	} else {
-		log.Println("No category filter or 'all' selected, returning all products")
-		rows, err = database.DB.Query(`
-			SELECT 
-				p.id, 
-				p.name, 
-				p.description, 
-				p.price, 
-				p.stock, 
-				p.category, 
-				p.image_url, 
-				COALESCE(u.name, 'Unknown Seller') as seller_name
-			FROM products p
-			LEFT JOIN users u ON p.seller_id = u.id
-			ORDER BY p.created_at DESC
-		`)
-	}
-
+	query, err := parseProductQuery(r.URL.Query())
 	if err != nil {
-		log.Printf("Error fetching products: %v", err)
-		http.Error(w, "Failed to fetch products", http.StatusInternalServerError)
-		return
-	}
-
-	log.Println("Successfully executed query")
-	defer rows.Close()
-
-	var products []models.ProductWithSeller
-	for rows.Next() {
-		var p models.ProductWithSeller
-		err := rows.Scan(
-			&p.ID,
-			&p.Name,
-			&p.Description,
-			&p.Price,
-			&p.Stock,
-			&p.Category,
-			&p.ImageURL,
-			&p.SellerName,
-		)
-		if err != nil {
-			log.Printf("Error scanning product: %v", err)
-			continue
-		}
-		log.Printf("Found product: ID=%d, Name=%s, Seller=%s", p.ID, p.Name, p.SellerName)
-		products = append(products, p)
+		apierror.Write(w, r, err)
+		return
 	}
 
-	// Check for any errors during iteration
-	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating over products: %v", err)
-		http.Error(w, "Error reading products", http.StatusInternalServerError)
+	page, err := s.products.ListProducts(r.Context(), query)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error fetching products", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Failed to fetch products"))
 		return
 	}
 
 	// Always return an array, even if empty
-	if products == nil {
-		products = make([]models.ProductWithSeller, 0)
+	if page.Products == nil {
+		page.Products = make([]models.ProductWithSeller, 0)
 	}
 
 	response := struct {
-		Success  bool                      `json:"success"`
-		Products []models.ProductWithSeller `json:"products"`
+		Success    bool                       `json:"success"`
+		Products   []models.ProductWithSeller `json:"products"`
+		NextCursor *string                    `json:"next_cursor"`
+		Total      int                        `json:"total"`
+		Limit      int                        `json:"limit"`
 	}{
 		Success:  true,
-		Products: products,
+		Products: page.Products,
+		Total:    page.Total,
+		Limit:    query.Limit,
+	}
+	if page.Next != nil {
+		cursor := page.Next.Encode()
+		response.NextCursor = &cursor
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding response to JSON: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error encoding response to JSON", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error encoding response"))
 		return
 	}
-	log.Printf("Successfully returned %d products", len(products))
+	slog.DebugContext(r.Context(), "returned products", "count", len(page.Products), "total", page.Total)
 }
 
-// AddToCartHandler handles adding items to cart
-func AddToCartHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// relatedProductsLimit is how many related products the product page shows
+const relatedProductsLimit = 8
+
+// GetProductDetailsHandler returns one product with its seller's public profile, its stock status and
+// related products, for /api/shop/products/{id}
+func (s *Server) GetProductDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
 		return
 	}
 
-	var cartItem models.CartItem
-	if err := json.NewDecoder(r.Body).Decode(&cartItem); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		apierror.Write(w, r, apierror.NotFound("Product not found"))
 		return
 	}
 
-	// Check if product exists and has enough stock
-	var currentStock int
-	err := database.DB.QueryRow("SELECT stock FROM products WHERE id = $1", cartItem.ProductID).Scan(&currentStock)
-	if err == sql.ErrNoRows {
-		http.Error(w, "Product not found", http.StatusNotFound)
+	product, err := s.products.GetProduct(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Product not found"))
 		return
 	}
 	if err != nil {
-		log.Printf("Error checking product stock: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error fetching product", "product_id", id, "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Failed to fetch product"))
 		return
 	}
 
-	if currentStock < cartItem.Quantity {
-		http.Error(w, "Not enough stock", http.StatusBadRequest)
+	seller, err := s.users.GetSellerProfile(r.Context(), product.SellerID)
+	if errors.Is(err, store.ErrNotFound) {
+		seller = models.SellerProfile{ID: product.SellerID, Name: "Unknown Seller"}
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "error fetching seller profile", "seller_id", product.SellerID, "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Failed to fetch product"))
 		return
 	}
 
-	// Add to cart or update quantity
-	_, err = database.DB.Exec(`
-		INSERT INTO cart_items (user_id, product_id, quantity)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (user_id, product_id)
-		DO UPDATE SET quantity = cart_items.quantity + $3
-	`, cartItem.UserID, cartItem.ProductID, cartItem.Quantity)
-
+	related, err := s.products.ListRelatedProducts(r.Context(), product, relatedProductsLimit)
 	if err != nil {
-		log.Printf("Error adding to cart: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error fetching related products", "product_id", id, "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Failed to fetch product"))
 		return
 	}
+	if related == nil {
+		related = make([]models.ProductWithSeller, 0)
+	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Added to cart"})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Success bool `json:"success"`
+		models.ProductDetails
+	}{
+		Success: true,
+		ProductDetails: models.ProductDetails{
+			Product:     product,
+			Seller:      seller,
+			StockStatus: models.StockStatus(product.Stock),
+			Related:     related,
+		},
+	})
 }
 
-// GetCartItemsHandler returns all cart items for a user
-func GetCartItemsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// parseProductQuery reads the catalog filters, sort and page from the query string,
+// reporting every invalid parameter at once
+func parseProductQuery(params url.Values) (store.ProductQuery, error) {
+	q := store.ProductQuery{Sort: store.SortNewest, Limit: defaultCatalogLimit}
+	var errs [][]validate.FieldError
+
+	q.Categories = categoryParam(params)
+	errs = append(errs,
+		numberParam(params, "min_price", &q.MinPrice),
+		numberParam(params, "max_price", &q.MaxPrice),
+		numberParam(params, "seller_id", &q.SellerID),
+		numberParam(params, "limit", &q.Limit),
+		boolParam(params, "in_stock", &q.InStock),
+	)
+
+	sorts := make([]string, len(store.ProductSorts))
+	for i, sort := range store.ProductSorts {
+		sorts[i] = string(sort)
+	}
+	if value := params.Get("sort"); value != "" {
+		q.Sort = store.ProductSort(value)
+		errs = append(errs, validate.Field("sort", value, validate.OneOf(sorts...)))
 	}
 
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
-		return
+	errs = append(errs,
+		validate.Field("min_price", q.MinPrice, validate.NonNegative[float64]),
+		validate.Field("max_price", q.MaxPrice, validate.NonNegative[float64]),
+		validate.Field("seller_id", q.SellerID, validate.NonNegative[int]),
+		validate.Field("limit", q.Limit, validate.Positive[int], validate.AtMost(maxCatalogLimit)),
+	)
+	if q.MaxPrice > 0 && q.MinPrice > q.MaxPrice {
+		errs = append(errs, []validate.FieldError{{Field: "max_price", Message: "must not be less than min_price"}})
 	}
 
-	rows, err := database.DB.Query(`
-		SELECT c.id, c.quantity, p.id, p.name, p.price, p.image_url
-		FROM cart_items c
-		JOIN products p ON c.product_id = p.id
-		WHERE c.user_id = $1
-	`, userID)
-	if err != nil {
-		log.Printf("Error fetching cart items: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	if err := validate.Check(errs...); err != nil {
+		return q, err
 	}
-	defer rows.Close()
 
-	var cartItems []models.CartItemWithProduct
-	for rows.Next() {
-		var item models.CartItemWithProduct
-		err := rows.Scan(&item.ID, &item.Quantity, &item.Product.ID,
-			&item.Product.Name, &item.Product.Price, &item.Product.ImageURL)
+	// A cursor only makes sense for the sort order it came from
+	if token := params.Get("cursor"); token != "" {
+		after, err := store.DecodeProductCursor(token, q.Sort)
 		if err != nil {
-			log.Printf("Error scanning cart item: %v", err)
-			continue
+			return q, validate.Check([]validate.FieldError{{Field: "cursor", Message: "is invalid or was issued for a different sort order"}})
 		}
-		cartItems = append(cartItems, item)
+		q.After = after
 	}
+	return q, nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(cartItems)
+// categoryParam reads the category filter, given as repeated or comma-separated values; "all" means no filter.
+// Values are category slugs; names are accepted too and turned into their slugs.
+func categoryParam(params url.Values) []string {
+	var categories []string
+	for _, value := range params["category"] {
+		for _, category := range strings.Split(value, ",") {
+			if category = models.Slugify(category); category != "" && category != "all" {
+				categories = append(categories, category)
+			}
+		}
+	}
+	return categories
 }
 
-// GetProductCategoriesHandler returns all unique product categories
-func GetProductCategoriesHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("GetProductCategoriesHandler called with method: %s from %s", r.Method, r.RemoteAddr)
+// numberParam parses an optional numeric query parameter into dest, an *int or *float64
+func numberParam(params url.Values, name string, dest interface{}) []validate.FieldError {
+	value := params.Get(name)
+	if value == "" {
+		return nil
+	}
+	var err error
+	switch d := dest.(type) {
+	case *float64:
+		var f float64
+		if f, err = strconv.ParseFloat(value, 64); err == nil {
+			*d = f
+		}
+	case *int:
+		var n int
+		if n, err = strconv.Atoi(value); err == nil {
+			*d = n
+		}
+	}
+	if err != nil {
+		return []validate.FieldError{{Field: name, Message: "must be a number"}}
+	}
+	return nil
+}
 
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "*")
+// boolParam parses an optional true/false query parameter into dest
+func boolParam(params url.Values, name string, dest *bool) []validate.FieldError {
+	value := params.Get(name)
+	if value == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return []validate.FieldError{{Field: name, Message: "must be true or false"}}
+	}
+	*dest = b
+	return nil
+}
 
-	// Handle preflight request
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
+// AddToCartHandler handles adding items to cart
+func (s *Server) AddToCartHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
 		return
 	}
 
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var cartItem models.CartItem
+	if err := json.NewDecoder(r.Body).Decode(&cartItem); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid request body"))
+		return
+	}
+
+	if err := cartItem.ValidateAdd(); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	// Get all unique categories
-	log.Println("Querying database for unique product categories...")
+	// Items are always added to the authenticated user's cart
+	cartItem.UserID = principal.UserID
+
+	// Check if product exists and has enough stock
+	product, err := s.products.GetProduct(r.Context(), cartItem.ProductID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Product not found"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error checking product stock", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
 
-	rows, err := database.DB.Query(`
-		SELECT DISTINCT category 
-		FROM products 
-		WHERE category IS NOT NULL AND category != ''
-		ORDER BY category ASC
-	`)
+	if product.Stock < cartItem.Quantity {
+		apierror.Write(w, r, apierror.BadRequest("Not enough stock"))
+		return
+	}
 
+	// Add to cart or update quantity
+	err = s.carts.AddCartItem(r.Context(), cartItem.UserID, cartItem.ProductID, cartItem.Quantity)
+	if errors.Is(err, store.ErrInvalid) {
+		apierror.Write(w, r, apierror.From(err).WithMessage("Quantity must be positive"))
+		return
+	}
 	if err != nil {
-		log.Printf("Error fetching categories: %v", err)
-		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error adding to cart", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
 		return
 	}
 
-	log.Println("Successfully executed query")
-	defer rows.Close()
+	metrics.CartAdditions.Inc()
 
-	var categories []string
-	for rows.Next() {
-		var category string
-		err := rows.Scan(&category)
-		if err != nil {
-			log.Printf("Error scanning category: %v", err)
-			continue
-		}
-		categories = append(categories, category)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Added to cart"})
+}
+
+// GetCartItemsHandler returns all cart items for a user
+func (s *Server) GetCartItemsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	cartItems, err := s.carts.ListCartItems(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error fetching cart items", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
 	}
 
-	// Check for any errors during iteration
-	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating over categories: %v", err)
-		http.Error(w, "Error reading categories", http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cartItems)
+}
+
+// GetProductCategoriesHandler returns the category tree. Each category counts the products in it and in
+// its subcategories, which is what filtering the catalog by its slug returns.
+func (s *Server) GetProductCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	categories, err := s.categories.ListCategories(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error fetching categories", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Failed to fetch categories"))
 		return
 	}
 
 	// Always return an array, even if empty
-	if categories == nil {
-		categories = make([]string, 0)
+	tree := models.CategoryTree(categories)
+	if tree == nil {
+		tree = make([]models.Category, 0)
 	}
 
 	response := struct {
-		Success    bool     `json:"success"`
-		Categories []string `json:"categories"`
+		Success    bool              `json:"success"`
+		Categories []models.Category `json:"categories"`
 	}{
 		Success:    true,
-		Categories: categories,
+		Categories: tree,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding response to JSON: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "error encoding response to JSON", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Error encoding response"))
 		return
 	}
-	log.Printf("Successfully returned %d categories", len(categories))
+	slog.DebugContext(r.Context(), "returned categories", "count", len(categories))
 }
 
 // UpdateCartItemHandler updates the quantity of a cart item
-func UpdateCartItemHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) UpdateCartItemHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
 		return
 	}
 
 	var cartItem models.CartItem
 	if err := json.NewDecoder(r.Body).Decode(&cartItem); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid request body"))
+		return
+	}
+	if err := cartItem.ValidateUpdate(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// Make sure the cart item belongs to the authenticated user
+	existing, err := s.carts.GetCartItem(r.Context(), cartItem.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Cart item not found"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error checking cart item owner", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+	if existing.UserID != principal.UserID {
+		apierror.Write(w, r, apierror.Forbidden("You do not have permission to modify this cart item"))
 		return
 	}
 
 	if cartItem.Quantity <= 0 {
 		// Delete the item if quantity is 0 or negative
-		_, err := database.DB.Exec("DELETE FROM cart_items WHERE id = $1", cartItem.ID)
-		if err != nil {
-			log.Printf("Error deleting cart item: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+		err = s.carts.DeleteCartItem(r.Context(), cartItem.ID, principal.UserID)
 	} else {
 		// Update the quantity
-		_, err := database.DB.Exec("UPDATE cart_items SET quantity = $1 WHERE id = $2",
-			cartItem.Quantity, cartItem.ID)
-		if err != nil {
-			log.Printf("Error updating cart item: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+		err = s.carts.UpdateCartItemQuantity(r.Context(), cartItem.ID, principal.UserID, cartItem.Quantity)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Cart item not found"))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error updating cart item", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
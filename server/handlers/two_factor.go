@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/store"
+	"github.com/rythmokay/golang/server/utils"
+)
+
+// createTwoFactorChallenge stores a short-lived challenge that must be completed at /api/auth/2fa
+func (s *Server) createTwoFactorChallenge(ctx context.Context, userID int) (string, time.Time, error) {
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(s.cfg.Auth.TwoFactorChallengeTTL)
+	if err := s.twoFactor.CreateChallenge(ctx, userID, tokenHash, expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// EnrollTwoFactorHandler starts TOTP enrollment by generating a secret for the authenticated seller.
+// Two-factor is not enforced until the secret is confirmed with ConfirmTwoFactorHandler.
+func (s *Server) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := s.users.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error fetching user for two-factor enrollment", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		apierror.Write(w, r, apierror.Conflict("Two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating TOTP secret", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	if err := s.twoFactor.SetTOTPSecret(r.Context(), principal.UserID, secret); err != nil {
+		slog.ErrorContext(r.Context(), "error saving TOTP secret", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(secret, user.Email, s.cfg.Auth.TwoFactorIssuer),
+	})
+}
+
+// ConfirmTwoFactorHandler enables two-factor once the seller proves their authenticator works,
+// and returns one-time recovery codes that are never shown again.
+func (s *Server) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	principal, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		apierror.Write(w, r, apierror.BadRequest("Code is required"))
+		return
+	}
+
+	user, err := s.users.GetUserByID(r.Context(), principal.UserID)
+	var secret string
+	if err == nil {
+		secret, err = s.twoFactor.GetTOTPSecret(r.Context(), principal.UserID)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error fetching user for two-factor confirmation", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		apierror.Write(w, r, apierror.Conflict("Two-factor authentication is already enabled"))
+		return
+	}
+	if secret == "" {
+		apierror.Write(w, r, apierror.BadRequest("Start two-factor enrollment first"))
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(secret, input.Code, time.Now())
+	if !valid {
+		apierror.Write(w, r, apierror.Unauthorized("Invalid code"))
+		return
+	}
+
+	recoveryCodes := make([]string, 0, s.cfg.Auth.TwoFactorRecoveryCodeCount)
+	codeHashes := make([]string, 0, s.cfg.Auth.TwoFactorRecoveryCodeCount)
+	for i := 0; i < s.cfg.Auth.TwoFactorRecoveryCodeCount; i++ {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error generating recovery code", "err", err)
+			apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+			return
+		}
+		recoveryCodes = append(recoveryCodes, code)
+		codeHashes = append(codeHashes, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+	}
+
+	if err := s.twoFactor.EnableTwoFactor(r.Context(), principal.UserID, step, codeHashes); err != nil {
+		slog.ErrorContext(r.Context(), "error enabling two-factor", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	slog.InfoContext(r.Context(), "two-factor enabled")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// VerifyTwoFactorHandler completes a login challenge with a TOTP code or a recovery code and issues a session
+func (s *Server) VerifyTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		apierror.Write(w, r, apierror.MethodNotAllowed())
+		return
+	}
+
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid request format"))
+		return
+	}
+	if input.ChallengeToken == "" || (input.Code == "" && input.RecoveryCode == "") {
+		apierror.Write(w, r, apierror.BadRequest("Challenge token and a code or recovery code are required"))
+		return
+	}
+
+	challenge, err := s.twoFactor.GetChallenge(r.Context(), utils.HashToken(input.ChallengeToken), s.cfg.Auth.TwoFactorMaxAttempts)
+	if errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, apierror.Unauthorized("Challenge is invalid or has expired. Please log in again."))
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error looking up two-factor challenge", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+	user := challenge.User
+
+	// Wrong codes count towards the login lockout, which applies here as well
+	ip := utils.ClientIP(r)
+	if !s.loginAllowed(w, r, user.Email, ip) {
+		return
+	}
+
+	// A code is only accepted once: the store refuses time steps no newer than the last one used
+	err = store.ErrInvalidCode
+	if input.Code != "" {
+		if step, valid := utils.ValidateTOTP(challenge.Secret, input.Code, time.Now()); valid {
+			err = s.twoFactor.CompleteChallengeWithCode(r.Context(), challenge.ID, user.ID, step)
+		}
+	} else {
+		codeHash := utils.HashToken(utils.NormalizeRecoveryCode(input.RecoveryCode))
+		err = s.twoFactor.CompleteChallengeWithRecoveryCode(r.Context(), challenge.ID, user.ID, codeHash)
+	}
+	switch {
+	case errors.Is(err, store.ErrInvalidCode):
+		// Count the wrong code against the challenge and the login throttle
+		if err := s.twoFactor.FailChallenge(r.Context(), challenge.ID); err != nil {
+			slog.ErrorContext(r.Context(), "error counting two-factor attempt", "err", err)
+		}
+		s.recordLoginFailure(r.Context(), user.Email, ip)
+		apierror.Write(w, r, apierror.Unauthorized("Invalid code"))
+		return
+	case errors.Is(err, store.ErrNotFound):
+		apierror.Write(w, r, apierror.Unauthorized("Challenge is invalid or has expired. Please log in again."))
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "error verifying two-factor code", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	session, err := s.issueSession(r.Context(), user.ID, user.Role)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating token", "err", err)
+		apierror.Write(w, r, apierror.From(err).WithMessage("Internal server error"))
+		return
+	}
+
+	s.clearLoginFailures(r.Context(), user.Email)
+
+	if input.RecoveryCode != "" {
+		s.recordAuthEvent(r.Context(), "recovery_code_used", user.Email, ip, map[string]interface{}{"user_id": user.ID})
+	}
+
+	slog.InfoContext(r.Context(), "two-factor login successful", "user_id", user.ID)
+	json.NewEncoder(w).Encode(loginResponse(user, session))
+}
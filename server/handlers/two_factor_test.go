@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rythmokay/golang/server/models"
+)
+
+// totpCode computes the authenticator app code for secret at the given 30-second time step (RFC 6238)
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff%1000000)
+}
+
+// enableTwoFactor enrolls a seller and returns their TOTP secret and recovery codes
+func enableTwoFactor(t *testing.T, s *Server, id int) (string, []interface{}) {
+	t.Helper()
+	r := jsonRequest(t, http.MethodPost, "/api/auth/2fa/enroll", nil)
+	secret := serve(t, s.EnrollTwoFactorHandler, asUser(r, id, models.RoleSeller), http.StatusOK)["secret"].(string)
+
+	r = jsonRequest(t, http.MethodPost, "/api/auth/2fa/confirm", map[string]string{
+		"code": totpCode(t, secret, time.Now().Unix()/30),
+	})
+	body := serve(t, s.ConfirmTwoFactorHandler, asUser(r, id, models.RoleSeller), http.StatusOK)
+	return secret, body["recovery_codes"].([]interface{})
+}
+
+// verifyTwoFactor completes a login challenge through VerifyTwoFactorHandler
+func verifyTwoFactor(t *testing.T, s *Server, input map[string]string, want int) map[string]interface{} {
+	t.Helper()
+	return serve(t, s.VerifyTwoFactorHandler, jsonRequest(t, http.MethodPost, "/api/auth/2fa", input), want)
+}
+
+func TestTwoFactorLoginAcceptsEachCodeOnce(t *testing.T) {
+	s, _ := newTestServer(t)
+	id := userID(signup(t, s, "grace@example.com", models.RoleSeller))
+	secret, recoveryCodes := enableTwoFactor(t, s, id)
+
+	body := login(t, s, "grace@example.com", "correct horse", http.StatusOK)
+	if body["two_factor_required"] != true {
+		t.Fatalf("login did not ask for a second factor: %v", body)
+	}
+	challenge := body["challenge_token"].(string)
+
+	// The code used to confirm enrollment has been spent
+	step := time.Now().Unix() / 30
+	verifyTwoFactor(t, s, map[string]string{"challenge_token": challenge, "code": totpCode(t, secret, step)}, http.StatusUnauthorized)
+
+	next := totpCode(t, secret, step+1)
+	body = verifyTwoFactor(t, s, map[string]string{"challenge_token": challenge, "code": next}, http.StatusOK)
+	if body["refresh_token"] == nil {
+		t.Errorf("verification issued no session: %v", body)
+	}
+	verifyTwoFactor(t, s, map[string]string{"challenge_token": challenge, "code": next}, http.StatusUnauthorized)
+
+	// A recovery code works once, on a new challenge
+	code := recoveryCodes[0].(string)
+	for _, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		challenge := login(t, s, "grace@example.com", "correct horse", http.StatusOK)["challenge_token"].(string)
+		verifyTwoFactor(t, s, map[string]string{"challenge_token": challenge, "recovery_code": code}, want)
+	}
+}
+
+func TestTwoFactorChallengeEndsAfterMaxAttempts(t *testing.T) {
+	s, _ := newTestServer(t)
+	id := userID(signup(t, s, "grace@example.com", models.RoleSeller))
+	secret, _ := enableTwoFactor(t, s, id)
+	challenge := login(t, s, "grace@example.com", "correct horse", http.StatusOK)["challenge_token"].(string)
+
+	for i := 0; i < s.cfg.Auth.TwoFactorMaxAttempts; i++ {
+		verifyTwoFactor(t, s, map[string]string{"challenge_token": challenge, "recovery_code": "wrong-code"}, http.StatusUnauthorized)
+	}
+	body := verifyTwoFactor(t, s, map[string]string{
+		"challenge_token": challenge, "code": totpCode(t, secret, time.Now().Unix()/30+1),
+	}, http.StatusUnauthorized)
+	if msg := body["error"].(map[string]interface{})["message"]; !strings.Contains(msg.(string), "log in again") {
+		t.Errorf("message = %q, want the challenge to have ended", msg)
+	}
+}
@@ -0,0 +1,116 @@
+// Package logging sets up the JSON structured logger used by the whole server.
+// Log lines written with a request context carry that request's ID and authenticated user,
+// and personal data such as email addresses is masked before it is written.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// level is shared by every handler created by Setup so it can be changed while the server runs
+var level slog.LevelVar
+
+// Setup makes a JSON logger writing to w the default for both log/slog and the standard log package
+func Setup(w io.Writer, lvl string) error {
+	if err := SetLevel(lvl); err != nil {
+		return err
+	}
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       &level,
+		ReplaceAttr: redact,
+	})
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
+
+// SetLevel changes the minimum level logged: debug, info, warn or error
+func SetLevel(lvl string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(lvl)); err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// Level returns the minimum level currently logged
+func Level() slog.Level {
+	return level.Level()
+}
+
+// contextHandler adds the request ID and user ID stored by Middleware to every record logged with a request context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if info := infoFrom(ctx); info != nil {
+		r.AddAttrs(slog.String("request_id", info.id))
+		if info.userID != 0 {
+			r.AddAttrs(slog.Int("user_id", info.userID))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// piiKeys are attribute keys whose values are never written as is
+var piiKeys = map[string]bool{
+	"email":            true,
+	"phone":            true,
+	"phone_number":     true,
+	"contact_number":   true,
+	"address":          true,
+	"shipping_address": true,
+	"password":         true,
+	"token":            true,
+}
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@([A-Za-z0-9.\-]+\.[A-Za-z]{2,})`)
+
+// redact masks personal data: values of the keys in piiKeys, and email addresses found in any
+// string or error, for example inside a database error message
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if piiKeys[strings.ToLower(a.Key)] {
+		if a.Key == "email" {
+			return slog.String(a.Key, MaskEmail(a.Value.String()))
+		}
+		return slog.String(a.Key, "[redacted]")
+	}
+
+	switch v := a.Value.Any().(type) {
+	case string:
+		if strings.Contains(v, "@") {
+			return slog.String(a.Key, maskEmails(v))
+		}
+	case error:
+		if msg := v.Error(); strings.Contains(msg, "@") {
+			return slog.String(a.Key, maskEmails(msg))
+		}
+	}
+	return a
+}
+
+// MaskEmail keeps the first character and the domain of an address, e.g. j***@example.com
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return "[redacted]"
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+func maskEmails(s string) string {
+	return emailPattern.ReplaceAllStringFunc(s, MaskEmail)
+}
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rythmokay/golang/server/response"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey struct{}
+
+// requestInfo is shared by everything handling one request so that handlers further down
+// can attach the user ID to the request's log lines
+type requestInfo struct {
+	id     string
+	userID int
+}
+
+func infoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(contextKey{}).(*requestInfo)
+	return info
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside a request
+func RequestID(ctx context.Context) string {
+	if info := infoFrom(ctx); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// SetUserID records the authenticated user of the request ctx belongs to
+func SetUserID(ctx context.Context, userID int) {
+	if info := infoFrom(ctx); info != nil {
+		info.userID = userID
+	}
+}
+
+// Middleware gives every request an ID, echoed in the X-Request-ID response header, and writes
+// one access log line per request. A valid X-Request-ID sent by the client is kept so requests
+// can be traced across services. routes is only used to name the matched route in the log.
+func Middleware(routes *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		info := &requestInfo{id: id}
+		ctx := context.WithValue(r.Context(), contextKey{}, info)
+		w.Header().Set(RequestIDHeader, id)
+
+		_, route := routes.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		rec := response.NewRecorder(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		lvl := slog.LevelInfo
+		if rec.Status >= http.StatusInternalServerError {
+			lvl = slog.LevelError
+		}
+		slog.Log(ctx, lvl, "request",
+			"method", r.Method,
+			"route", route,
+			"status", rec.Status,
+			"bytes", rec.Bytes,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+		)
+	})
+}
+
+// validRequestID accepts short IDs made of characters that are safe to echo and log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
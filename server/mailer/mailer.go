@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sender delivers outgoing email
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// LogSender writes emails to the server log instead of delivering them.
+// It is meant for local development.
+type LogSender struct{}
+
+// Send logs the email at debug level. The body holds one-time links, so it is only
+// included when debug logging is on, and the recipient is masked like any other email.
+func (LogSender) Send(to, subject, body string) error {
+	slog.Debug("email", "email", to, "subject", subject, "body", body)
+	return nil
+}
+
+// FileSender appends emails to a file so they can be inspected by tests and developers
+type FileSender struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewFileSender returns a sender that appends emails to the file at path
+func NewFileSender(path string) *FileSender {
+	return &FileSender{Path: path}
+}
+
+// Send appends the email to the outbox file
+func (s *FileSender) Send(to, subject, body string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n----\n",
+		time.Now().Format(time.RFC1123Z), to, subject, body)
+	return err
+}
@@ -1,77 +1,189 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/rs/cors"
 
 	"github.com/rythmokay/golang/server/config"
 	"github.com/rythmokay/golang/server/database"
 	"github.com/rythmokay/golang/server/handlers"
+	"github.com/rythmokay/golang/server/logging"
+	"github.com/rythmokay/golang/server/mailer"
+	"github.com/rythmokay/golang/server/metrics"
+	"github.com/rythmokay/golang/server/store/postgres"
+	"github.com/rythmokay/golang/server/utils"
 )
 
-func init() {
-	if err := database.Initialize(config.DBConnStr); err != nil {
-		log.Fatal("❌ Error initializing database:", err)
+func main() {
+	configPath := flag.String("config", os.Getenv("SHOP_CONFIG"), "path to a YAML config file; SHOP_* environment variables override it")
+	flag.Parse()
+
+	// Log JSON from the start; the configured level is applied once the config is loaded
+	logging.Setup(os.Stderr, "info")
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatal("error loading configuration", "err", err)
 	}
+	logging.SetLevel(cfg.Log.Level)
+	slog.Info("configuration loaded", "config", cfg.String())
 
-	// Run database migrations
-	if err := database.RunMigrations(); err != nil {
-		log.Fatal("❌ Error running migrations:", err)
+	if err := database.Initialize(cfg.Database); err != nil {
+		fatal("error initializing database", "err", err)
 	}
-}
 
-func main() {
-	// Enable CORS for all origins in development
+	// "server migrate ..." manages the schema and exits without serving
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		os.Exit(runMigrateCommand(args[1:]))
+	}
+
+	// "server admin ..." manages administrator accounts and exits without serving
+	if args := flag.Args(); len(args) > 0 && args[0] == "admin" {
+		os.Exit(runAdminCommand(args[1:]))
+	}
+
+	// Bring the schema up to date before serving requests
+	applied, err := database.MigrateUp()
+	if err != nil {
+		fatal("error running migrations", "err", err)
+	}
+	slog.Info("database schema is up to date", "applied", applied)
+
+	// Make sure nothing outside the migrations has changed the schema
+	drift, err := database.CheckSchemaDrift()
+	if err != nil {
+		fatal("error checking schema drift", "err", err)
+	}
+	if len(drift) > 0 {
+		for _, d := range drift {
+			slog.Warn("schema drift", "difference", d)
+		}
+		if cfg.Database.SchemaDriftFatal {
+			fatal("database schema differs from the migrations; refusing to start", "differences", len(drift))
+		}
+	}
+
+	// Write outgoing email to a file when configured, otherwise it is only logged
+	var mail mailer.Sender = mailer.LogSender{}
+	if cfg.Mail.OutboxFile != "" {
+		mail = mailer.NewFileSender(cfg.Mail.OutboxFile)
+	}
+
+	// Only the configured storefront origins may call the API from a browser
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"}, // Allow all origins in development
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
 		AllowedHeaders:   []string{"Content-Type", "Authorization", "Accept", "Origin", "X-Requested-With"},
 		ExposedHeaders:   []string{"Content-Length", "Content-Type"},
 		MaxAge:           86400, // 24 hours for preflight cache
-		AllowCredentials: false, // Must be false if AllowedOrigins is "*"
-		Debug:            true,
+		AllowCredentials: false, // Tokens are sent in the Authorization header, not cookies
+		Debug:            cfg.Environment == "development",
+		Logger:           slog.NewLogLogger(slog.Default().Handler(), slog.LevelDebug),
 	})
 
-	// Create a new mux for our API
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api/health", handlers.HealthCheck)
-	mux.HandleFunc("/api/signup", handlers.SignupHandler)
-	mux.HandleFunc("/api/login", handlers.LoginHandler)
-
-	// Product routes
-	mux.HandleFunc("/api/products/create", handlers.CreateProductHandler)
-	mux.HandleFunc("/api/products/seller", handlers.GetSellerProductsHandler)
-	mux.HandleFunc("/api/products/update", handlers.UpdateProductHandler)
-	mux.HandleFunc("/api/products/delete", handlers.DeleteProductHandler)
-
-	// Shop routes
-	mux.HandleFunc("/api/shop/products", handlers.GetAllProductsHandler)
-	mux.HandleFunc("/api/shop/categories", handlers.GetProductCategoriesHandler)
-
-	// Cart routes
-	mux.HandleFunc("/api/cart", handlers.GetCartItemsHandler)
-	mux.HandleFunc("/api/cart/add", handlers.AddToCartHandler)
-	mux.HandleFunc("/api/cart/update", handlers.UpdateCartItemHandler)
-
-	// Profile routes
-	mux.HandleFunc("/api/profile", handlers.GetProfile)
-	mux.HandleFunc("/api/profile/update", handlers.UpdateProfile)
-
-	// Order routes
-	mux.HandleFunc("/api/checkout", handlers.CheckoutHandler)
-	mux.HandleFunc("/api/orders/user", handlers.GetUserOrdersHandler)
-	mux.HandleFunc("/api/orders/seller", handlers.GetSellerOrdersHandler)
-	mux.HandleFunc("/api/orders/details", handlers.GetOrderDetailsHandler)
-	mux.HandleFunc("/api/orders/seller-details", handlers.GetSellerOrderDetailsHandler)
-	mux.HandleFunc("/api/orders/update-status", handlers.UpdateOrderStatusHandler)
-
-	// Wrap the mux with CORS middleware
-	handler := c.Handler(mux)
-
-	log.Println("🚀 Server started at http://localhost" + config.ServerPort)
-	if err := http.ListenAndServe(config.ServerPort, handler); err != nil {
-		log.Fatal("❌ Server error:", err)
+	// Export connection pool statistics alongside the HTTP and business metrics
+	metrics.RegisterDB(database.DB, "ecommerce")
+
+	stores := postgres.NewStores(database.DB)
+	auth := utils.NewAuthenticator(cfg.Auth, stores.Users, stores.Sessions)
+	server := handlers.NewServer(cfg, auth, stores, mail, database.DB)
+
+	mux := routes(server, auth)
+
+	// Wrap the mux with CORS middleware and bound the database work of each request.
+	// The logging and metrics middleware go outermost so every response, preflights included, is recorded.
+	handler := logging.Middleware(mux, metrics.Middleware(mux, c.Handler(utils.QueryDeadline(cfg.Database.QueryTimeout, mux))))
+
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	// Metrics get their own listener so the public API never exposes them
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", metrics.Handler())
+	metricsSrv := &http.Server{
+		Addr:              cfg.Server.MetricsAddr,
+		Handler:           metricsMux,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	// SIGHUP re-reads the config file and applies its log level without a restart
+	go reloadLogLevel(*configPath)
+
+	// Stop accepting connections on SIGINT/SIGTERM and let in-flight requests finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 2)
+	go func() {
+		slog.Info("server listening", "addr", cfg.Server.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+	go func() {
+		slog.Info("metrics listening", "addr", cfg.Server.MetricsAddr)
+		serveErr <- metricsSrv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal("server error", "err", err)
+		}
+	case <-ctx.Done():
+		stop()
+		slog.Info("shutting down, waiting for in-flight requests", "timeout", cfg.Server.ShutdownTimeout.String())
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("graceful shutdown did not finish", "err", err)
+			srv.Close()
+		}
+		metricsSrv.Close()
+	}
+
+	if err := database.DB.Close(); err != nil {
+		slog.Error("error closing database", "err", err)
+	}
+	slog.Info("server stopped")
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// reloadLogLevel applies the log level from a freshly loaded configuration each time the process receives SIGHUP
+func reloadLogLevel(configPath string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			slog.Error("not reloading log level, configuration is invalid", "err", err)
+			continue
+		}
+		if err := logging.SetLevel(cfg.Log.Level); err != nil {
+			slog.Error("invalid log level", "err", err)
+			continue
+		}
+		slog.Info("log level changed", "level", logging.Level().String())
 	}
 }
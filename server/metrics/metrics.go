@@ -0,0 +1,79 @@
+// Package metrics exposes Prometheus metrics for HTTP traffic, the database pool and shop activity.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// registry holds only the server's own metrics plus the Go runtime and process collectors
+var registry = prometheus.NewRegistry()
+
+var factory = promauto.With(registry)
+
+var (
+	httpRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "shop",
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "shop",
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method and route pattern.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"method", "route"})
+
+	// OrdersCreated counts successful checkouts by payment method
+	OrdersCreated = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "shop",
+		Name:      "orders_created_total",
+		Help:      "Orders placed, by payment method.",
+	}, []string{"payment_method"})
+
+	// CheckoutFailures counts rejected checkouts by reason
+	CheckoutFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "shop",
+		Name:      "checkout_failures_total",
+		Help:      "Checkouts that did not create an order, by reason.",
+	}, []string{"reason"})
+
+	// CartAdditions counts products added to carts
+	CartAdditions = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: "shop",
+		Name:      "cart_additions_total",
+		Help:      "Successful add-to-cart requests.",
+	})
+)
+
+// Checkout failure reasons
+const (
+	CheckoutInvalidRequest    = "invalid_request"
+	CheckoutEmailUnverified   = "email_unverified"
+	CheckoutEmptyCart         = "empty_cart"
+	CheckoutInsufficientStock = "insufficient_stock"
+	CheckoutInternalError     = "internal_error"
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// RegisterDB exports the connection pool statistics of db (open, in use, idle, waits) as go_sql_* metrics
+func RegisterDB(db *sql.DB, name string) {
+	registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
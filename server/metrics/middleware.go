@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rythmokay/golang/server/response"
+)
+
+// Middleware counts and times every request. Requests are labelled with the route pattern they
+// matched in routes rather than their raw path, so the number of series stays bounded.
+func Middleware(routes *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		_, route := routes.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		rec := response.NewRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		method := methodLabel(r.Method)
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(rec.Status)).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// methodLabel returns method if it is a standard HTTP method and "other" otherwise,
+// since clients can send any token as the method
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/rythmokay/golang/server/database"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    revert the last n applied migrations (default 1)
+  status      list migrations and whether they have been applied
+  redo        revert and re-apply the last applied migration
+  check       compare the live schema with the one the migrations produce`
+
+// runMigrateCommand implements the "migrate" subcommand and returns the process exit code
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp()
+		if err != nil {
+			slog.Error("migration failed", "err", err)
+			return 1
+		}
+		slog.Info("migrations applied", "count", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "down expects a positive number of migrations to revert")
+				return 2
+			}
+			steps = n
+		}
+		reverted, err := database.MigrateDown(steps)
+		if err != nil {
+			slog.Error("migration failed", "err", err)
+			return 1
+		}
+		slog.Info("migrations reverted", "count", reverted)
+
+	case "redo":
+		if err := database.RedoMigration(); err != nil {
+			slog.Error("migration failed", "err", err)
+			return 1
+		}
+		slog.Info("migration redo complete")
+
+	case "status":
+		statuses, err := database.MigrationStatuses()
+		if err != nil {
+			slog.Error("could not read migration status", "err", err)
+			return 1
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range statuses {
+			state, appliedAt := "pending", ""
+			if s.Applied {
+				state = "applied"
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			if s.ChecksumMismatch {
+				state = "modified"
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+		}
+		tw.Flush()
+
+	case "check":
+		drift, err := database.CheckSchemaDrift()
+		if err != nil {
+			slog.Error("could not check schema drift", "err", err)
+			return 1
+		}
+		if len(drift) == 0 {
+			slog.Info("database schema matches the migrations")
+			return 0
+		}
+		for _, d := range drift {
+			fmt.Println(d)
+		}
+		return 1
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rythmokay/golang/server/validate"
+)
+
+// Category is a node in the catalog's category tree
+type Category struct {
+	ID int `json:"id"`
+	// ParentID is nil for top-level categories
+	ParentID *int   `json:"parent_id"`
+	Name     string `json:"name"`
+	// Slug identifies the category in URLs and catalog filters
+	Slug string `json:"slug"`
+	// Position orders a category among its siblings, lowest first
+	Position int `json:"position"`
+	// ProductCount is the number of products filed under the category; in a tree built by CategoryTree
+	// it includes the products of its subcategories
+	ProductCount int        `json:"product_count"`
+	Children     []Category `json:"children,omitempty"`
+}
+
+var (
+	slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+	slugPattern    = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// Slugify turns a category name into its slug: lower case, with every run of characters other than
+// ASCII letters and digits replaced by one hyphen. It is the same expression the category migration
+// used on the old free-text values, so "Electronics" and "electronics " both become "electronics".
+func Slugify(name string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// NormalizeCategoryName trims a category name and collapses runs of whitespace inside it
+func NormalizeCategoryName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// validSlug requires lower-case letters and digits separated by single hyphens
+func validSlug(s string) string {
+	if s != "" && !slugPattern.MatchString(s) {
+		return "must be lower-case letters and digits separated by hyphens"
+	}
+	return ""
+}
+
+// Validate checks a category created or updated by an administrator
+func (c Category) Validate() error {
+	var parent []validate.FieldError
+	if c.ParentID != nil {
+		parent = validate.Field("parent_id", *c.ParentID, validate.Positive[int])
+	}
+	return validate.Check(
+		validate.Field("name", c.Name, validate.Required, validate.MaxLength(100)),
+		validate.Field("slug", c.Slug, validate.Required, validate.MaxLength(100), validSlug),
+		parent,
+		validate.Field("position", c.Position, validate.NonNegative[int]),
+	)
+}
+
+// CategoryTree nests a flat list of categories under their parents, keeping the order of the list among
+// siblings, and adds the product counts of each category's subcategories to its own
+func CategoryTree(categories []Category) []Category {
+	children := map[int][]Category{} // by parent id, 0 for top-level categories
+	for _, c := range categories {
+		parent := 0
+		if c.ParentID != nil {
+			parent = *c.ParentID
+		}
+		children[parent] = append(children[parent], c)
+	}
+
+	var build func(parent int) []Category
+	build = func(parent int) []Category {
+		nodes := children[parent]
+		for i := range nodes {
+			nodes[i].Children = build(nodes[i].ID)
+			for _, child := range nodes[i].Children {
+				nodes[i].ProductCount += child.ProductCount
+			}
+		}
+		return nodes
+	}
+	return build(0)
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/rythmokay/golang/server/validate"
 )
 
 // ExtendedOrder represents an order placed by a user with additional fields for the checkout system
@@ -49,9 +51,14 @@ type OrderWithItemDetails struct {
 	UserName   string                 `json:"user_name,omitempty"`
 }
 
+// SellerOrder is an order as listed for a seller, with the name of the customer who placed it
+type SellerOrder struct {
+	ExtendedOrder
+	UserName string `json:"user_name"`
+}
+
 // CheckoutRequest represents the data needed for checkout
 type CheckoutRequest struct {
-	UserID          int     `json:"user_id"`
 	PaymentMethod   string  `json:"payment_method"`
 	ShippingAddress string  `json:"shipping_address"`
 	ContactNumber   string  `json:"contact_number"`
@@ -64,3 +71,23 @@ type PaymentResponse struct {
 	OrderID   string `json:"order_id"`
 	Status    string `json:"status"`
 }
+
+// Payment methods accepted at checkout
+const (
+	PaymentRazorpay = "razorpay"
+	PaymentCOD      = "cod"
+)
+
+// Validate checks a checkout request. Razorpay payments must carry the gateway's payment ID.
+func (c CheckoutRequest) Validate() error {
+	paymentID := []validate.Rule[string]{validate.MaxLength(100)}
+	if c.PaymentMethod == PaymentRazorpay {
+		paymentID = append([]validate.Rule[string]{validate.Required}, paymentID...)
+	}
+	return validate.Check(
+		validate.Field("payment_method", c.PaymentMethod, validate.OneOf(PaymentRazorpay, PaymentCOD)),
+		validate.Field("shipping_address", c.ShippingAddress, validate.Required),
+		validate.Field("contact_number", c.ContactNumber, validate.Required, validate.MaxLength(20), validate.Phone),
+		validate.Field("payment_id", c.PaymentID, paymentID...),
+	)
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/rythmokay/golang/server/validate"
+)
 
 // Product represents a product in the system
 type Product struct {
@@ -10,8 +14,57 @@ type Product struct {
 	Description string    `json:"description"`
 	Price       float64   `json:"price"`
 	Stock       int       `json:"stock"`
+	CategoryID  int       `json:"category_id"`
 	Category    string    `json:"category"`
 	ImageURL    string    `json:"image_url"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+// maxPrice is the largest value a DECIMAL(10,2) price column holds
+const maxPrice = 99999999.99
+
+// Validate checks a product created or updated by a seller. The category is given by category_id,
+// or by name from clients that predate the category tree.
+func (p Product) Validate() error {
+	category := validate.Field("category", p.Category, validate.Required, validate.MaxLength(100))
+	if p.CategoryID != 0 {
+		category = validate.Field("category_id", p.CategoryID, validate.Positive[int])
+	}
+	return validate.Check(
+		validate.Field("name", p.Name, validate.Required, validate.MaxLength(200)),
+		validate.Field("price", p.Price, validate.Positive[float64], validate.AtMost(maxPrice)),
+		validate.Field("stock", p.Stock, validate.NonNegative[int]),
+		category,
+	)
+}
+
+// Stock statuses shown on the product page
+const (
+	StockInStock    = "in_stock"
+	StockLow        = "low_stock"
+	StockOutOfStock = "out_of_stock"
+)
+
+// LowStockThreshold is the stock level at or below which a product is shown as running low
+const LowStockThreshold = 5
+
+// StockStatus describes a stock level for shoppers
+func StockStatus(stock int) string {
+	switch {
+	case stock <= 0:
+		return StockOutOfStock
+	case stock <= LowStockThreshold:
+		return StockLow
+	default:
+		return StockInStock
+	}
+}
+
+// ProductDetails is everything the product page shows: the product, who sells it and what else to look at
+type ProductDetails struct {
+	Product     Product             `json:"product"`
+	Seller      SellerProfile       `json:"seller"`
+	StockStatus string              `json:"stock_status"`
+	Related     []ProductWithSeller `json:"related"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// ProductSearchResult is a product found by a catalog search.
+// The highlights are HTML-escaped text with the matched words wrapped in <mark> tags.
+type ProductSearchResult struct {
+	ProductWithSeller
+	// Rank is the relevance of the match; higher is better
+	Rank          float64 `json:"rank"`
+	NameHighlight string  `json:"name_highlight"`
+	Snippet       string  `json:"snippet"`
+}
+
+// Suggestions are search box completions for what the customer has typed so far
+type Suggestions struct {
+	Products   []ProductSuggestion  `json:"products"`
+	Categories []CategorySuggestion `json:"categories"`
+	Sellers    []SellerSuggestion   `json:"sellers"`
+}
+
+// ProductSuggestion is a product whose name matches the typed text
+type ProductSuggestion struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// CategorySuggestion is a category matching the typed text, with how many products it and its subcategories have
+type CategorySuggestion struct {
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`
+	ProductCount int    `json:"product_count"`
+}
+
+// SellerSuggestion is a seller with products whose name matches the typed text
+type SellerSuggestion struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// SearchMiss is a search that customers made which found nothing
+type SearchMiss struct {
+	Query    string `json:"query"`
+	Searches int    `json:"searches"`
+	// LastSearched is the most recent day the query was searched for
+	LastSearched time.Time `json:"last_searched"`
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/rythmokay/golang/server/validate"
+)
 
 type ProductWithSeller struct {
 	ID          int     `json:"id"`
@@ -10,7 +14,10 @@ type ProductWithSeller struct {
 	Stock       int     `json:"stock"`
 	Category    string  `json:"category"`
 	ImageURL    string  `json:"image_url"`
+	SellerID    int     `json:"seller_id"`
 	SellerName  string  `json:"seller_name"`
+	// CreatedAt is when the product was listed
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type CartItem struct {
@@ -45,3 +52,18 @@ type OrderItem struct {
 	PriceAtTime float64 `json:"price_at_time"`
 	Product     Product `json:"product,omitempty"`
 }
+
+// ValidateAdd checks a request to add a product to the cart
+func (c CartItem) ValidateAdd() error {
+	return validate.Check(
+		validate.Field("product_id", c.ProductID, validate.Positive[int]),
+		validate.Field("quantity", c.Quantity, validate.Positive[int]),
+	)
+}
+
+// ValidateUpdate checks a request to change a cart item. A quantity of 0 or less removes the item.
+func (c CartItem) ValidateUpdate() error {
+	return validate.Check(
+		validate.Field("id", c.ID, validate.Positive[int]),
+	)
+}
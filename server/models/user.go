@@ -1,12 +1,84 @@
 package models
 
+import (
+	"time"
+
+	"github.com/rythmokay/golang/server/validate"
+)
+
+// User roles stored in users.role
+const (
+	RoleSeller   = "seller"
+	RoleCustomer = "customer"
+	// RoleAdmin manages the category tree. Admins are promoted with "server admin grant", never through signup.
+	RoleAdmin = "admin"
+)
+
 // User represents a user in the system
 type User struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	Email       string `json:"email"`
-	Password    string `json:"password"`
-	Role        string `json:"role"`
-	Address     string `json:"address"`
-	PhoneNumber string `json:"phone_number"`
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	Password      string `json:"password"`
+	Role          string `json:"role"`
+	Address       string `json:"address"`
+	PhoneNumber   string `json:"phone_number"`
+	EmailVerified bool   `json:"email_verified"`
+	// TwoFactorEnabled is true once the user has confirmed a TOTP enrollment
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+}
+
+// SellerProfile is the public information about a seller shown alongside their products
+type SellerProfile struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// MemberSince is when the seller signed up, if known
+	MemberSince  *time.Time `json:"member_since,omitempty"`
+	ProductCount int        `json:"product_count"`
+}
+
+// UserDataExport is the personal data archive returned by /api/profile/export
+type UserDataExport struct {
+	ExportedAt time.Time              `json:"exported_at"`
+	Profile    User                   `json:"profile"`
+	CreatedAt  time.Time              `json:"created_at"`
+	Addresses  []string               `json:"addresses"`
+	Cart       []CartItemWithProduct  `json:"cart"`
+	Orders     []OrderWithItemDetails `json:"orders"`
+	Products   []Product              `json:"products,omitempty"`
+}
+
+// ValidateSignup checks a signup request. minPasswordLength comes from the auth configuration.
+func (u User) ValidateSignup(minPasswordLength int) error {
+	return validate.Check(
+		validate.Field("name", u.Name, validate.Required, validate.MaxLength(100)),
+		validate.Field("email", u.Email, validate.Required, validate.MaxLength(100), validate.Email),
+		validate.Field("password", u.Password, validate.Required, validate.MinLength(minPasswordLength), validate.MaxBytes(72)),
+		validate.Field("role", u.Role, validate.OneOf(RoleSeller, RoleCustomer)),
+		validate.Field("address", u.Address, validate.MaxLength(255)),
+		validate.Field("phone_number", u.PhoneNumber, validate.MaxLength(20), validate.Phone),
+	)
+}
+
+// ValidateProfile checks the fields a user may change on their profile
+func (u User) ValidateProfile() error {
+	return validate.Check(
+		validate.Field("name", u.Name, validate.Required, validate.MaxLength(100)),
+		validate.Field("address", u.Address, validate.MaxLength(255)),
+		validate.Field("phone_number", u.PhoneNumber, validate.MaxLength(20), validate.Phone),
+	)
+}
+
+// ValidatePassword checks a new password against the same rules as signup
+func ValidatePassword(field, password string, minPasswordLength int) error {
+	return validate.Check(
+		validate.Field(field, password, validate.Required, validate.MinLength(minPasswordLength), validate.MaxBytes(72)),
+	)
+}
+
+// ValidateEmail checks a new email address against the same rules as signup
+func ValidateEmail(field, email string) error {
+	return validate.Check(
+		validate.Field(field, email, validate.Required, validate.MaxLength(100), validate.Email),
+	)
 }
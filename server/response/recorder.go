@@ -0,0 +1,38 @@
+// Package response holds the response writer wrapper shared by the logging and metrics middleware.
+// It imports nothing from the server so that every middleware package can use it.
+package response
+
+import "net/http"
+
+// Recorder remembers the status code and body size written through it
+type Recorder struct {
+	http.ResponseWriter
+	Status      int
+	Bytes       int
+	wroteHeader bool
+}
+
+// NewRecorder wraps w; the status is 200 until the handler writes another one
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *Recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.Status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
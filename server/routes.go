@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/rythmokay/golang/server/handlers"
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/utils"
+)
+
+// routes returns the API mux, with authentication and role guards applied to each route
+func routes(server *handlers.Server, auth *utils.Authenticator) *http.ServeMux {
+	mux := http.NewServeMux()
+	// Liveness only says the process is up; readiness checks the database and schema.
+	// /api/health is kept for existing callers and now reports readiness.
+	mux.HandleFunc("/api/health/live", server.LiveHandler)
+	mux.HandleFunc("/api/health/ready", server.ReadyHandler)
+	mux.HandleFunc("/api/health", server.ReadyHandler)
+	mux.HandleFunc("/api/signup", server.SignupHandler)
+	mux.HandleFunc("/api/login", server.LoginHandler)
+
+	// Session routes
+	mux.HandleFunc("/api/auth/refresh", server.RefreshHandler)
+	mux.HandleFunc("/api/auth/logout", auth.Middleware(server.LogoutHandler))
+	mux.HandleFunc("/api/auth/logout-all", auth.Middleware(server.LogoutAllHandler))
+	mux.HandleFunc("/api/auth/forgot-password", server.ForgotPasswordHandler)
+	mux.HandleFunc("/api/auth/reset-password", server.ResetPasswordHandler)
+	mux.HandleFunc("/api/auth/verify-email", server.VerifyEmailHandler)
+	mux.HandleFunc("/api/auth/resend-verification", auth.Middleware(server.ResendVerificationHandler))
+	mux.HandleFunc("/api/auth/2fa", server.VerifyTwoFactorHandler)
+
+	// Role guards, applied after authentication
+	seller := func(h http.HandlerFunc) http.HandlerFunc {
+		return auth.Middleware(utils.RequireRole(models.RoleSeller, h))
+	}
+	customer := func(h http.HandlerFunc) http.HandlerFunc {
+		return auth.Middleware(utils.RequireRole(models.RoleCustomer, h))
+	}
+	admin := func(h http.HandlerFunc) http.HandlerFunc {
+		return auth.Middleware(utils.RequireRole(models.RoleAdmin, h))
+	}
+
+	// Two-factor enrollment (sellers only)
+	mux.HandleFunc("/api/auth/2fa/enroll", seller(server.EnrollTwoFactorHandler))
+	mux.HandleFunc("/api/auth/2fa/confirm", seller(server.ConfirmTwoFactorHandler))
+
+	// Product routes (sellers only)
+	mux.HandleFunc("/api/products/create", seller(server.CreateProductHandler))
+	mux.HandleFunc("/api/products/seller", seller(server.GetSellerProductsHandler))
+	mux.HandleFunc("/api/products/update", seller(server.UpdateProductHandler))
+	mux.HandleFunc("/api/products/delete", seller(server.DeleteProductHandler))
+	mux.HandleFunc("/api/products/search-misses", seller(server.GetSearchMissesHandler))
+
+	// Shop routes (public catalog)
+	mux.HandleFunc("/api/shop/products", server.GetAllProductsHandler)
+	mux.HandleFunc("/api/shop/products/{id}", server.GetProductDetailsHandler)
+	mux.HandleFunc("/api/shop/categories", server.GetProductCategoriesHandler)
+	mux.HandleFunc("/api/shop/search", server.SearchProductsHandler)
+	mux.HandleFunc("/api/shop/suggest", server.SuggestHandler)
+
+	// Category tree management (administrators only)
+	mux.HandleFunc("/api/admin/categories/create", admin(server.CreateCategoryHandler))
+	mux.HandleFunc("/api/admin/categories/update", admin(server.UpdateCategoryHandler))
+	mux.HandleFunc("/api/admin/categories/delete", admin(server.DeleteCategoryHandler))
+
+	// Cart routes (customers only)
+	mux.HandleFunc("/api/cart", customer(server.GetCartItemsHandler))
+	mux.HandleFunc("/api/cart/add", customer(server.AddToCartHandler))
+	mux.HandleFunc("/api/cart/update", customer(server.UpdateCartItemHandler))
+
+	// Profile routes (any signed-in user)
+	mux.HandleFunc("/api/profile", auth.Middleware(server.GetProfile))
+	mux.HandleFunc("/api/profile/update", auth.Middleware(server.UpdateProfile))
+	mux.HandleFunc("/api/profile/password", auth.Middleware(server.ChangePasswordHandler))
+	mux.HandleFunc("/api/profile/email", auth.Middleware(server.ChangeEmailHandler))
+	mux.HandleFunc("/api/profile/export", auth.Middleware(server.ExportDataHandler))
+	mux.HandleFunc("/api/profile/delete", auth.Middleware(server.DeleteAccountHandler))
+
+	// Customer order routes
+	mux.HandleFunc("/api/checkout", customer(server.CheckoutHandler))
+	mux.HandleFunc("/api/orders/user", customer(server.GetUserOrdersHandler))
+	mux.HandleFunc("/api/orders/details", customer(server.GetOrderDetailsHandler))
+
+	// Seller order routes
+	mux.HandleFunc("/api/orders/seller", seller(server.GetSellerOrdersHandler))
+	mux.HandleFunc("/api/orders/seller-details", seller(server.GetSellerOrderDetailsHandler))
+	mux.HandleFunc("/api/orders/update-status", seller(server.UpdateOrderStatusHandler))
+
+	return mux
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rythmokay/golang/server/models"
+)
+
+var (
+	// ErrTokenReused is returned when a refresh token that was already rotated is presented again.
+	// Its whole token family has been revoked by the time the error is returned.
+	ErrTokenReused = errors.New("refresh token reused")
+	// ErrTokenExpired is returned when a refresh token is past its expiry
+	ErrTokenExpired = errors.New("refresh token expired")
+	// ErrInvalidCode is returned when a two-factor code was already used or a recovery code does not match
+	ErrInvalidCode = errors.New("invalid two-factor code")
+)
+
+// Session is the login a refresh token belongs to
+type Session struct {
+	UserID int
+	// Role is the user's current role, for the access token issued with a rotated refresh token
+	Role string
+	// FamilyID is shared by every refresh token descending from one login
+	FamilyID string
+}
+
+// RefreshToken is a stored refresh token. Only the hash of the token handed to the client is kept.
+type RefreshToken struct {
+	UserID    int
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+// TwoFactorChallenge is a pending second login step, with what is needed to check the code sent for it
+type TwoFactorChallenge struct {
+	ID   int
+	User models.User
+	// Secret is the user's TOTP secret
+	Secret string
+	// LastStep is the time step of the last TOTP code accepted, or nil if none has been
+	LastStep *int64
+}
+
+// Login throttle scopes. Account keys are normalized email addresses, IP keys are client addresses.
+const (
+	ThrottleScopeAccount = "account"
+	ThrottleScopeIP      = "ip"
+)
+
+// ThrottleKey identifies what failed logins are counted against
+type ThrottleKey struct {
+	Scope string
+	Key   string
+}
+
+// AuthEvent is a security-relevant event kept in the audit log
+type AuthEvent struct {
+	Event string
+	// Email is the address the event concerns, if any
+	Email     string
+	IP        string
+	Details   map[string]interface{}
+	CreatedAt time.Time
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rythmokay/golang/server/models"
+)
+
+// ProductSort is an order the storefront catalog can be listed in
+type ProductSort string
+
+// Catalog sort orders. Every order ends with the product id so each position in the listing is unique.
+const (
+	SortNewest    ProductSort = "newest"
+	SortPriceAsc  ProductSort = "price_asc"
+	SortPriceDesc ProductSort = "price_desc"
+	SortName      ProductSort = "name"
+	SortPopular   ProductSort = "popular"
+)
+
+// ProductSorts lists the valid sort orders
+var ProductSorts = []ProductSort{SortNewest, SortPriceAsc, SortPriceDesc, SortName, SortPopular}
+
+// ErrInvalidCursor is returned when a page cursor is malformed or was issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ProductQuery selects a page of the storefront catalog. Zero values mean "no filter".
+type ProductQuery struct {
+	// Categories keeps products in any of the categories with these slugs, or in their subcategories
+	Categories []string
+	MinPrice   float64
+	MaxPrice   float64
+	// InStock keeps only products with stock left
+	InStock  bool
+	SellerID int
+	Sort     ProductSort
+	// After continues the listing after the last product of a previous page
+	After *ProductCursor
+	Limit int
+}
+
+// ProductPage is one page of the catalog
+type ProductPage struct {
+	Products []models.ProductWithSeller
+	// Next is the cursor for the following page, or nil on the last page
+	Next *ProductCursor
+	// Total is how many products match the filters across all pages
+	Total int
+}
+
+// ProductCursor is the position of a product in a sorted listing: the value of the sort key and the id
+type ProductCursor struct {
+	Sort      ProductSort `json:"s"`
+	ID        int         `json:"id"`
+	CreatedAt time.Time   `json:"c,omitempty"`
+	Price     float64     `json:"p,omitempty"`
+	Name      string      `json:"n,omitempty"`
+	UnitsSold int         `json:"u,omitempty"`
+}
+
+// Encode returns the cursor as an opaque URL-safe token
+func (c ProductCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeProductCursor parses a token from Encode and checks that it belongs to the given sort order
+func DecodeProductCursor(token string, sort ProductSort) (*ProductCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c ProductCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 || c.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// SearchQuery is a full-text search of the catalog
+type SearchQuery struct {
+	Text string
+	// Categories are category slugs, as in ProductQuery
+	Categories []string
+	InStock    bool
+	Limit      int
+	Offset     int
+}
+
+// SearchPage is one page of search results, best match first
+type SearchPage struct {
+	Results []models.ProductSearchResult
+	// Total is how many products match across all pages
+	Total int
+	// Fuzzy is true when no product contained the search words and the results are near misses by name
+	Fuzzy bool
+}
+
+// maxSearchTerms bounds how many words of a query are searched for
+const maxSearchTerms = 10
+
+var searchTermPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// SearchTerms splits search text into lowercase words, dropping punctuation and query operators
+func SearchTerms(text string) []string {
+	return searchTermPattern.FindAllString(strings.ToLower(text), maxSearchTerms)
+}
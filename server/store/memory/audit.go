@@ -0,0 +1,32 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/rythmokay/golang/server/store"
+)
+
+// AuditStore is the in-memory implementation of store.AuditStore
+type AuditStore struct {
+	d *data
+}
+
+// RecordEvent appends an event to the audit log
+func (s *AuditStore) RecordEvent(ctx context.Context, e store.AuthEvent) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	e.CreatedAt = time.Now()
+	s.d.auditLog = append(s.d.auditLog, e)
+	return nil
+}
+
+// Events returns the audit log, oldest first. Postgres keeps it in auth_audit_log, which nothing in the
+// server reads back; this lets tests see what was recorded.
+func (s *AuditStore) Events() []store.AuthEvent {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	return append([]store.AuthEvent(nil), s.d.auditLog...)
+}
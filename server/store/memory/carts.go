@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// CartStore is the in-memory implementation of store.CartStore
+type CartStore struct {
+	d *data
+}
+
+// AddCartItem adds a product to a cart or increases its quantity
+func (s *CartStore) AddCartItem(ctx context.Context, userID, productID, quantity int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.products[productID]; !ok {
+		return store.ErrInvalid
+	}
+	for id, item := range s.d.cartItems {
+		if item.UserID == userID && item.ProductID == productID {
+			item.Quantity += quantity
+			if item.Quantity <= 0 {
+				return store.ErrInvalid
+			}
+			s.d.cartItems[id] = item
+			return nil
+		}
+	}
+	if quantity <= 0 {
+		return store.ErrInvalid
+	}
+	id := s.d.id()
+	s.d.cartItems[id] = models.CartItem{ID: id, UserID: userID, ProductID: productID, Quantity: quantity}
+	return nil
+}
+
+// GetCartItem looks up a cart item by id
+func (s *CartStore) GetCartItem(ctx context.Context, id int) (models.CartItem, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	item, ok := s.d.cartItems[id]
+	if !ok {
+		return models.CartItem{}, store.ErrNotFound
+	}
+	return item, nil
+}
+
+// ListCartItems returns a user's cart with product details
+func (s *CartStore) ListCartItems(ctx context.Context, userID int) ([]models.CartItemWithProduct, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var items []models.CartItemWithProduct
+	for _, id := range sortedIDs(s.d.cartItems) {
+		item := s.d.cartItems[id]
+		p, ok := s.d.products[item.ProductID]
+		if item.UserID != userID || !ok {
+			continue
+		}
+		items = append(items, models.CartItemWithProduct{
+			ID:       item.ID,
+			Quantity: item.Quantity,
+			Product:  models.Product{ID: p.ID, Name: p.Name, Price: p.Price, ImageURL: p.ImageURL},
+		})
+	}
+	return items, nil
+}
+
+// UpdateCartItemQuantity sets the quantity of a user's cart item
+func (s *CartStore) UpdateCartItemQuantity(ctx context.Context, id, userID, quantity int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	item, ok := s.d.cartItems[id]
+	if !ok || item.UserID != userID {
+		return store.ErrNotFound
+	}
+	if quantity <= 0 {
+		return store.ErrInvalid
+	}
+	item.Quantity = quantity
+	s.d.cartItems[id] = item
+	return nil
+}
+
+// DeleteCartItem removes a user's cart item
+func (s *CartStore) DeleteCartItem(ctx context.Context, id, userID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	item, ok := s.d.cartItems[id]
+	if !ok || item.UserID != userID {
+		return store.ErrNotFound
+	}
+	delete(s.d.cartItems, id)
+	return nil
+}
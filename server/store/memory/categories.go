@@ -0,0 +1,201 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// CategoryStore is the in-memory implementation of store.CategoryStore
+type CategoryStore struct {
+	d *data
+}
+
+// validCategory applies the same checks as the categories table constraints
+func validCategory(c *models.Category) bool {
+	return !blank(c.Name) && c.Slug != "" && c.Position >= 0
+}
+
+// withProductCount returns c counting the products filed directly under it
+func (d *data) withProductCount(c models.Category) models.Category {
+	c.ProductCount = 0
+	for _, p := range d.products {
+		if p.CategoryID == c.ID && d.listed(p) {
+			c.ProductCount++
+		}
+	}
+	return c
+}
+
+// categoryTaken reports whether a category other than c has its slug, or a sibling of c has its name
+func (d *data) categoryTaken(c *models.Category) bool {
+	for _, other := range d.categories {
+		if other.ID == c.ID {
+			continue
+		}
+		if other.Slug == c.Slug {
+			return true
+		}
+		if parentOf(other) == parentOf(*c) && strings.EqualFold(other.Name, c.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// parentOf returns the parent id of c, or 0 for a top-level category
+func parentOf(c models.Category) int {
+	if c.ParentID == nil {
+		return 0
+	}
+	return *c.ParentID
+}
+
+// categorySubtree returns the ids of the categories with the given slugs and of all their subcategories
+func (d *data) categorySubtree(slugs []string) map[int]bool {
+	ids := map[int]bool{}
+	for _, c := range d.categories {
+		if slices.Contains(slugs, c.Slug) {
+			ids[c.ID] = true
+		}
+	}
+	// Keep adding children of categories already in the set until nothing changes
+	for grown := true; grown; {
+		grown = false
+		for _, c := range d.categories {
+			if !ids[c.ID] && c.ParentID != nil && ids[*c.ParentID] {
+				ids[c.ID] = true
+				grown = true
+			}
+		}
+	}
+	return ids
+}
+
+// ListCategories returns every category with the number of products filed directly under it
+func (s *CategoryStore) ListCategories(ctx context.Context) ([]models.Category, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var categories []models.Category
+	for _, id := range sortedIDs(s.d.categories) {
+		categories = append(categories, s.d.withProductCount(s.d.categories[id]))
+	}
+	sort.SliceStable(categories, func(i, j int) bool {
+		if categories[i].Position != categories[j].Position {
+			return categories[i].Position < categories[j].Position
+		}
+		return categories[i].Name < categories[j].Name
+	})
+	return categories, nil
+}
+
+// GetCategory looks up a category by id
+func (s *CategoryStore) GetCategory(ctx context.Context, id int) (models.Category, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	c, ok := s.d.categories[id]
+	if !ok {
+		return models.Category{}, store.ErrNotFound
+	}
+	return s.d.withProductCount(c), nil
+}
+
+// GetCategoryBySlug looks up a category by slug
+func (s *CategoryStore) GetCategoryBySlug(ctx context.Context, slug string) (models.Category, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, c := range s.d.categories {
+		if c.Slug == slug {
+			return s.d.withProductCount(c), nil
+		}
+	}
+	return models.Category{}, store.ErrNotFound
+}
+
+// CreateCategory inserts a new category
+func (s *CategoryStore) CreateCategory(ctx context.Context, c *models.Category) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if !validCategory(c) {
+		return store.ErrInvalid
+	}
+	if _, ok := s.d.categories[parentOf(*c)]; c.ParentID != nil && !ok {
+		return store.ErrInvalid
+	}
+	if s.d.categoryTaken(c) {
+		return store.ErrCategoryExists
+	}
+	c.ID = s.d.id()
+	c.Children = nil
+	s.d.categories[c.ID] = *c
+	return nil
+}
+
+// UpdateCategory saves a category and copies its name onto its products
+func (s *CategoryStore) UpdateCategory(ctx context.Context, c *models.Category) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.categories[c.ID]; !ok {
+		return store.ErrNotFound
+	}
+	if !validCategory(c) {
+		return store.ErrInvalid
+	}
+	if c.ParentID != nil {
+		// Walk up from the new parent; meeting the category itself means the move would make a loop
+		for id := *c.ParentID; id != 0; {
+			if id == c.ID {
+				return store.ErrCategoryCycle
+			}
+			parent, ok := s.d.categories[id]
+			if !ok {
+				return store.ErrInvalid
+			}
+			id = parentOf(parent)
+		}
+	}
+	if s.d.categoryTaken(c) {
+		return store.ErrCategoryExists
+	}
+
+	c.Children = nil
+	s.d.categories[c.ID] = *c
+	for id, p := range s.d.products {
+		if p.CategoryID == c.ID {
+			p.Category = c.Name
+			s.d.products[id] = p
+		}
+	}
+	return nil
+}
+
+// DeleteCategory removes a category that nothing refers to
+func (s *CategoryStore) DeleteCategory(ctx context.Context, id int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.categories[id]; !ok {
+		return store.ErrNotFound
+	}
+	for _, c := range s.d.categories {
+		if parentOf(c) == id {
+			return store.ErrCategoryInUse
+		}
+	}
+	for _, p := range s.d.products {
+		if p.CategoryID == id {
+			return store.ErrCategoryInUse
+		}
+	}
+	delete(s.d.categories, id)
+	return nil
+}
@@ -0,0 +1,117 @@
+// Package memory implements the store interfaces in process memory.
+// It mirrors the behaviour of the Postgres stores closely enough to test handlers without a database.
+package memory
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// data is shared by all stores returned from one NewStores call, like tables in one database
+type data struct {
+	mu         sync.Mutex
+	nextID     int
+	users      map[int]models.User
+	products   map[int]models.Product
+	categories map[int]models.Category
+	cartItems  map[int]models.CartItem
+	orders     map[int]models.ExtendedOrder
+	orderItems map[int]models.ExtendedOrderItem
+	// searchMisses counts searches that found nothing by query and day
+	searchMisses map[searchMissKey]int
+	// unlistedProducts holds the ids of products hidden from the storefront, like products.unlisted_at
+	unlistedProducts map[int]bool
+
+	// deletedUsers holds the ids of anonymized accounts, like users.deleted_at
+	deletedUsers   map[int]bool
+	refreshTokens  map[int]refreshToken
+	passwordResets map[int]singleUseToken
+	verifications  map[int]singleUseToken
+	totp           map[int]totpState
+	recoveryCodes  map[int]recoveryCode
+	challenges     map[int]challenge
+	throttles      map[store.ThrottleKey]throttle
+	auditLog       []store.AuthEvent
+}
+
+type searchMissKey struct {
+	query string
+	day   time.Time
+}
+
+func (d *data) id() int {
+	d.nextID++
+	return d.nextID
+}
+
+// listed reports whether p is shown on the storefront
+func (d *data) listed(p models.Product) bool {
+	return !d.unlistedProducts[p.ID]
+}
+
+// NewStores returns empty in-memory stores that share one data set
+func NewStores() store.Stores {
+	d := &data{
+		users:        map[int]models.User{},
+		products:     map[int]models.Product{},
+		categories:   map[int]models.Category{},
+		cartItems:    map[int]models.CartItem{},
+		orders:       map[int]models.ExtendedOrder{},
+		orderItems:   map[int]models.ExtendedOrderItem{},
+		searchMisses: map[searchMissKey]int{},
+
+		unlistedProducts: map[int]bool{},
+
+		deletedUsers:   map[int]bool{},
+		refreshTokens:  map[int]refreshToken{},
+		passwordResets: map[int]singleUseToken{},
+		verifications:  map[int]singleUseToken{},
+		totp:           map[int]totpState{},
+		recoveryCodes:  map[int]recoveryCode{},
+		challenges:     map[int]challenge{},
+		throttles:      map[store.ThrottleKey]throttle{},
+	}
+	return store.Stores{
+		Users:      &UserStore{d},
+		Products:   &ProductStore{d},
+		Categories: &CategoryStore{d},
+		Carts:      &CartStore{d},
+		Orders:     &OrderStore{d},
+
+		Sessions:       &SessionStore{d},
+		PasswordResets: &PasswordResetStore{d},
+		Verifications:  &VerificationStore{d},
+		TwoFactor:      &TwoFactorStore{d},
+		Throttles:      &ThrottleStore{d},
+		Audit:          &AuditStore{d},
+	}
+}
+
+// sortedIDs returns the keys of m in ascending order so results are deterministic
+func sortedIDs[T any](m map[int]T) []int {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// newestFirst sorts by creation time descending, breaking ties by id like insertion order would
+func newestFirst(created func(i int) time.Time, id func(i int) int) func(i, j int) bool {
+	return func(i, j int) bool {
+		if ci, cj := created(i), created(j); !ci.Equal(cj) {
+			return ci.After(cj)
+		}
+		return id(i) > id(j)
+	}
+}
+
+func blank(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// OrderStore is the in-memory implementation of store.OrderStore
+type OrderStore struct {
+	d *data
+}
+
+// Checkout places an order for everything in the user's cart
+func (s *OrderStore) Checkout(ctx context.Context, userID int, req models.CheckoutRequest, status string) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	// Check everything before changing anything so a failure leaves no trace, like a rolled back transaction
+	var lines []models.CartItem
+	totalAmount := 0.0
+	for _, id := range sortedIDs(s.d.cartItems) {
+		item := s.d.cartItems[id]
+		if item.UserID != userID {
+			continue
+		}
+		p, ok := s.d.products[item.ProductID]
+		if !ok || p.Stock < item.Quantity {
+			return 0, &store.InsufficientStockError{ProductID: item.ProductID}
+		}
+		lines = append(lines, item)
+		totalAmount += p.Price * float64(item.Quantity)
+	}
+	if len(lines) == 0 {
+		return 0, store.ErrEmptyCart
+	}
+
+	now := time.Now()
+	orderID := s.d.id()
+	s.d.orders[orderID] = models.ExtendedOrder{
+		ID:              orderID,
+		UserID:          userID,
+		TotalAmount:     totalAmount,
+		Status:          status,
+		PaymentMethod:   req.PaymentMethod,
+		PaymentID:       req.PaymentID,
+		ShippingAddress: req.ShippingAddress,
+		ContactNumber:   req.ContactNumber,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	for _, item := range lines {
+		p := s.d.products[item.ProductID]
+		itemID := s.d.id()
+		s.d.orderItems[itemID] = models.ExtendedOrderItem{
+			ID:        itemID,
+			OrderID:   orderID,
+			ProductID: p.ID,
+			SellerID:  p.SellerID,
+			Quantity:  item.Quantity,
+			Price:     p.Price,
+			CreatedAt: now,
+		}
+		p.Stock -= item.Quantity
+		s.d.products[p.ID] = p
+		delete(s.d.cartItems, item.ID)
+	}
+	return orderID, nil
+}
+
+// GetOrder looks up an order by id
+func (s *OrderStore) GetOrder(ctx context.Context, id int) (models.ExtendedOrder, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	o, ok := s.d.orders[id]
+	if !ok {
+		return models.ExtendedOrder{}, store.ErrNotFound
+	}
+	return o, nil
+}
+
+// ListUserOrders returns a customer's orders, newest first
+func (s *OrderStore) ListUserOrders(ctx context.Context, userID int) ([]models.ExtendedOrder, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var orders []models.ExtendedOrder
+	for _, id := range sortedIDs(s.d.orders) {
+		if o := s.d.orders[id]; o.UserID == userID {
+			orders = append(orders, o)
+		}
+	}
+	sort.SliceStable(orders, newestFirst(
+		func(i int) time.Time { return orders[i].CreatedAt },
+		func(i int) int { return orders[i].ID },
+	))
+	return orders, nil
+}
+
+// ListSellerOrders returns the orders containing a seller's products, newest first
+func (s *OrderStore) ListSellerOrders(ctx context.Context, sellerID int) ([]models.SellerOrder, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var orders []models.SellerOrder
+	for _, id := range sortedIDs(s.d.orders) {
+		if !s.sellerHasItems(id, sellerID) {
+			continue
+		}
+		o := s.d.orders[id]
+		orders = append(orders, models.SellerOrder{ExtendedOrder: o, UserName: s.d.users[o.UserID].Name})
+	}
+	sort.SliceStable(orders, newestFirst(
+		func(i int) time.Time { return orders[i].CreatedAt },
+		func(i int) int { return orders[i].ID },
+	))
+	return orders, nil
+}
+
+// ListOrderItems returns an order's items with product details
+func (s *OrderStore) ListOrderItems(ctx context.Context, orderID, sellerID int) ([]models.OrderItemWithDetails, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var items []models.OrderItemWithDetails
+	for _, id := range sortedIDs(s.d.orderItems) {
+		item := s.d.orderItems[id]
+		p, ok := s.d.products[item.ProductID]
+		if item.OrderID != orderID || !ok || (sellerID != 0 && p.SellerID != sellerID) {
+			continue
+		}
+		item.SellerID = p.SellerID
+		items = append(items, models.OrderItemWithDetails{
+			ExtendedOrderItem: item,
+			ProductName:       p.Name,
+			ProductImage:      p.ImageURL,
+		})
+	}
+	return items, nil
+}
+
+// sellerHasItems must be called with the lock held
+func (s *OrderStore) sellerHasItems(orderID, sellerID int) bool {
+	for _, item := range s.d.orderItems {
+		if p, ok := s.d.products[item.ProductID]; item.OrderID == orderID && ok && p.SellerID == sellerID {
+			return true
+		}
+	}
+	return false
+}
+
+// SellerHasItems reports whether an order exists and contains a seller's products
+func (s *OrderStore) SellerHasItems(ctx context.Context, orderID, sellerID int) (bool, bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	_, exists := s.d.orders[orderID]
+	return exists, exists && s.sellerHasItems(orderID, sellerID), nil
+}
+
+// UpdateOrderStatus changes the status of an order
+func (s *OrderStore) UpdateOrderStatus(ctx context.Context, orderID int, status string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	o, ok := s.d.orders[orderID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	o.Status, o.UpdatedAt = status, time.Now()
+	s.d.orders[orderID] = o
+	return nil
+}
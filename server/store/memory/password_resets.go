@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/rythmokay/golang/server/store"
+)
+
+// PasswordResetStore is the in-memory implementation of store.PasswordResetStore
+type PasswordResetStore struct {
+	d *data
+}
+
+// singleUseToken is an emailed token, for a password reset or an email verification
+type singleUseToken struct {
+	userID int
+	// email is the address an email verification token confirms
+	email     string
+	tokenHash string
+	expiresAt time.Time
+	used      bool
+	createdAt time.Time
+}
+
+// usable reports whether the token can still be redeemed
+func (t singleUseToken) usable() bool {
+	return !t.used && time.Now().Before(t.expiresAt)
+}
+
+// CreatePasswordReset stores a reset token and retires the user's earlier ones
+func (s *PasswordResetStore) CreatePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return store.ErrInvalid
+	}
+	for id, t := range s.d.passwordResets {
+		if t.userID == userID {
+			t.used = true
+			s.d.passwordResets[id] = t
+		}
+	}
+	s.d.passwordResets[s.d.id()] = singleUseToken{
+		userID: userID, tokenHash: tokenHash, expiresAt: expiresAt, createdAt: time.Now(),
+	}
+	return nil
+}
+
+// ResetPassword uses up a reset token, sets the new password and signs the user out everywhere
+func (s *PasswordResetStore) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for id, t := range s.d.passwordResets {
+		if t.tokenHash != tokenHash || !t.usable() {
+			continue
+		}
+		t.used = true
+		s.d.passwordResets[id] = t
+
+		u := s.d.users[t.userID]
+		u.Password = passwordHash
+		s.d.users[t.userID] = u
+		s.d.revokeSessions(func(rt refreshToken) bool { return rt.UserID == t.userID })
+		return t.userID, nil
+	}
+	return 0, store.ErrNotFound
+}
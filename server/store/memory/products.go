@@ -0,0 +1,276 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// ProductStore is the in-memory implementation of store.ProductStore
+type ProductStore struct {
+	d *data
+}
+
+// validProduct applies the same checks as the products table constraints and copies the name of the
+// product's category onto it
+func (d *data) validProduct(p *models.Product) bool {
+	c, ok := d.categories[p.CategoryID]
+	if !ok {
+		return false
+	}
+	p.Category = c.Name
+	return !blank(p.Name) && p.Price > 0 && p.Stock >= 0
+}
+
+// CreateProduct inserts a new product
+func (s *ProductStore) CreateProduct(ctx context.Context, p *models.Product) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if !s.d.validProduct(p) {
+		return store.ErrInvalid
+	}
+	p.ID = s.d.id()
+	s.d.products[p.ID] = *p
+	return nil
+}
+
+// GetProduct looks up a listed product by id
+func (s *ProductStore) GetProduct(ctx context.Context, id int) (models.Product, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	p, ok := s.d.products[id]
+	if !ok || !s.d.listed(p) {
+		return models.Product{}, store.ErrNotFound
+	}
+	return p, nil
+}
+
+// UpdateProduct saves the editable fields of a seller's product
+func (s *ProductStore) UpdateProduct(ctx context.Context, p *models.Product) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	existing, ok := s.d.products[p.ID]
+	if !ok || existing.SellerID != p.SellerID {
+		return store.ErrNotFound
+	}
+	if !s.d.validProduct(p) {
+		return store.ErrInvalid
+	}
+	existing.Name, existing.Description, existing.Price = p.Name, p.Description, p.Price
+	existing.Stock, existing.CategoryID, existing.Category, existing.ImageURL = p.Stock, p.CategoryID, p.Category, p.ImageURL
+	existing.UpdatedAt = p.UpdatedAt
+	s.d.products[p.ID] = existing
+	return nil
+}
+
+// DeleteProduct removes a seller's product
+func (s *ProductStore) DeleteProduct(ctx context.Context, id, sellerID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	existing, ok := s.d.products[id]
+	if !ok || existing.SellerID != sellerID {
+		return store.ErrNotFound
+	}
+	// Cart and order items refer to products like the foreign keys in Postgres
+	for _, item := range s.d.cartItems {
+		if item.ProductID == id {
+			return store.ErrProductInUse
+		}
+	}
+	for _, item := range s.d.orderItems {
+		if item.ProductID == id {
+			return store.ErrProductInUse
+		}
+	}
+	delete(s.d.products, id)
+	return nil
+}
+
+// ListRelatedProducts ranks other products by how many orders they share with p, then by whether they are
+// in p's category, in stock and selling well
+func (s *ProductStore) ListRelatedProducts(ctx context.Context, p models.Product, limit int) ([]models.ProductWithSeller, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	ordersWith := map[int]bool{}
+	unitsSold := map[int]int{}
+	for _, item := range s.d.orderItems {
+		if item.ProductID == p.ID {
+			ordersWith[item.OrderID] = true
+		}
+		unitsSold[item.ProductID] += item.Quantity
+	}
+	sharedOrders := map[int]map[int]bool{}
+	for _, item := range s.d.orderItems {
+		if item.ProductID != p.ID && ordersWith[item.OrderID] {
+			if sharedOrders[item.ProductID] == nil {
+				sharedOrders[item.ProductID] = map[int]bool{}
+			}
+			sharedOrders[item.ProductID][item.OrderID] = true
+		}
+	}
+
+	var candidates []models.Product
+	for _, id := range sortedIDs(s.d.products) {
+		c := s.d.products[id]
+		if c.ID != p.ID && s.d.listed(c) && (len(sharedOrders[c.ID]) > 0 || c.CategoryID == p.CategoryID) {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if len(sharedOrders[a.ID]) != len(sharedOrders[b.ID]) {
+			return len(sharedOrders[a.ID]) > len(sharedOrders[b.ID])
+		}
+		if (a.CategoryID == p.CategoryID) != (b.CategoryID == p.CategoryID) {
+			return a.CategoryID == p.CategoryID
+		}
+		if (a.Stock > 0) != (b.Stock > 0) {
+			return a.Stock > 0
+		}
+		return unitsSold[a.ID] > unitsSold[b.ID]
+	})
+
+	products := make([]models.ProductWithSeller, 0, min(limit, len(candidates)))
+	for _, c := range candidates[:min(limit, len(candidates))] {
+		sellerName := "Unknown Seller"
+		if u, ok := s.d.users[c.SellerID]; ok {
+			sellerName = u.Name
+		}
+		products = append(products, models.ProductWithSeller{
+			ID: c.ID, Name: c.Name, Description: c.Description, Price: c.Price, Stock: c.Stock,
+			Category: c.Category, ImageURL: c.ImageURL, SellerID: c.SellerID, SellerName: sellerName, CreatedAt: c.CreatedAt,
+		})
+	}
+	return products, nil
+}
+
+// ListSellerProducts returns a seller's products, newest first
+func (s *ProductStore) ListSellerProducts(ctx context.Context, sellerID int) ([]models.Product, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var products []models.Product
+	for _, id := range sortedIDs(s.d.products) {
+		if p := s.d.products[id]; p.SellerID == sellerID {
+			products = append(products, p)
+		}
+	}
+	sort.SliceStable(products, newestFirst(
+		func(i int) time.Time { return products[i].CreatedAt },
+		func(i int) int { return products[i].ID },
+	))
+	return products, nil
+}
+
+// ListProducts returns one page of the storefront catalog with seller names
+func (s *ProductStore) ListProducts(ctx context.Context, q store.ProductQuery) (store.ProductPage, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var page store.ProductPage
+	less, ok := catalogOrders[q.Sort]
+	if !ok {
+		return page, fmt.Errorf("unknown product sort %q", q.Sort)
+	}
+
+	// Popularity is the number of units ordered, which Postgres keeps in products.units_sold
+	unitsSold := map[int]int{}
+	for _, item := range s.d.orderItems {
+		unitsSold[item.ProductID] += item.Quantity
+	}
+
+	categories := s.d.categorySubtree(q.Categories)
+	var matches []store.ProductCursor
+	for _, p := range s.d.products {
+		if s.d.listed(p) && matchesQuery(p, q, categories) {
+			matches = append(matches, store.ProductCursor{
+				Sort: q.Sort, ID: p.ID, CreatedAt: p.CreatedAt, Price: p.Price, Name: p.Name, UnitsSold: unitsSold[p.ID],
+			})
+		}
+	}
+	page.Total = len(matches)
+	sort.Slice(matches, func(i, j int) bool { return less(matches[i], matches[j]) })
+
+	var last store.ProductCursor
+	for _, c := range matches {
+		if q.After != nil && !less(*q.After, c) {
+			continue
+		}
+		if len(page.Products) == q.Limit {
+			page.Next = &last
+			break
+		}
+		p := s.d.products[c.ID]
+		sellerName := "Unknown Seller"
+		if u, ok := s.d.users[p.SellerID]; ok {
+			sellerName = u.Name
+		}
+		page.Products = append(page.Products, models.ProductWithSeller{
+			ID: p.ID, Name: p.Name, Description: p.Description, Price: p.Price, Stock: p.Stock,
+			Category: p.Category, ImageURL: p.ImageURL, SellerID: p.SellerID, SellerName: sellerName, CreatedAt: p.CreatedAt,
+		})
+		last = c
+	}
+	return page, nil
+}
+
+// matchesQuery applies the filters of a catalog query. categories holds the ids of the filtered
+// categories and their subcategories, as returned by categorySubtree.
+func matchesQuery(p models.Product, q store.ProductQuery, categories map[int]bool) bool {
+	if len(q.Categories) > 0 && !categories[p.CategoryID] {
+		return false
+	}
+	if q.MinPrice > 0 && p.Price < q.MinPrice {
+		return false
+	}
+	if q.MaxPrice > 0 && p.Price > q.MaxPrice {
+		return false
+	}
+	if q.InStock && p.Stock <= 0 {
+		return false
+	}
+	return q.SellerID == 0 || p.SellerID == q.SellerID
+}
+
+// catalogOrders compares catalog positions for each sort order, breaking ties by id like the Postgres store
+var catalogOrders = map[store.ProductSort]func(a, b store.ProductCursor) bool{
+	store.SortNewest: func(a, b store.ProductCursor) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	},
+	store.SortPriceAsc: func(a, b store.ProductCursor) bool {
+		if a.Price != b.Price {
+			return a.Price < b.Price
+		}
+		return a.ID < b.ID
+	},
+	store.SortPriceDesc: func(a, b store.ProductCursor) bool {
+		if a.Price != b.Price {
+			return a.Price > b.Price
+		}
+		return a.ID > b.ID
+	},
+	store.SortName: func(a, b store.ProductCursor) bool {
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	},
+	store.SortPopular: func(a, b store.ProductCursor) bool {
+		if a.UnitsSold != b.UnitsSold {
+			return a.UnitsSold > b.UnitsSold
+		}
+		return a.ID > b.ID
+	},
+}
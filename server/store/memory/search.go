@@ -0,0 +1,284 @@
+package memory
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// Field weights, matching the A, B and C weights Postgres' ts_rank gives the name, category and description
+const (
+	nameWeight        = 1.0
+	categoryWeight    = 0.4
+	descriptionWeight = 0.2
+)
+
+// fuzzyThreshold is the share of a word's trigrams that must appear in a name, like pg_trgm.word_similarity_threshold
+const fuzzyThreshold = 0.6
+
+// SearchProducts approximates the Postgres full-text search: every word must prefix a word of the name,
+// category or description, and misspelled queries fall back to trigram similarity on the name
+func (s *ProductStore) SearchProducts(ctx context.Context, q store.SearchQuery) (store.SearchPage, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var page store.SearchPage
+	terms := store.SearchTerms(q.Text)
+	if len(terms) == 0 {
+		return page, nil
+	}
+
+	filters := store.ProductQuery{Categories: q.Categories, InStock: q.InStock}
+	categories := s.d.categorySubtree(q.Categories)
+	var results []models.ProductSearchResult
+	for _, id := range sortedIDs(s.d.products) {
+		p := s.d.products[id]
+		if !s.d.listed(p) || !matchesQuery(p, filters, categories) {
+			continue
+		}
+		if rank := textRank(p, terms); rank > 0 {
+			results = append(results, s.searchResult(p, rank, terms))
+		}
+	}
+
+	if len(results) == 0 {
+		page.Fuzzy = true
+		for _, id := range sortedIDs(s.d.products) {
+			p := s.d.products[id]
+			if !s.d.listed(p) || !matchesQuery(p, filters, categories) {
+				continue
+			}
+			if rank := nameSimilarity(p.Name, terms); rank >= fuzzyThreshold {
+				results = append(results, s.searchResult(p, rank, nil))
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Rank > results[j].Rank })
+	page.Total = len(results)
+	if q.Offset < len(results) {
+		results = results[q.Offset:]
+		if len(results) > q.Limit {
+			results = results[:q.Limit]
+		}
+		page.Results = results
+	}
+	return page, nil
+}
+
+// textRank sums the best field weight each term matches, or returns 0 when some term matches nothing
+func textRank(p models.Product, terms []string) float64 {
+	rank := 0.0
+	for _, term := range terms {
+		switch {
+		case hasPrefixWord(p.Name, term):
+			rank += nameWeight
+		case hasPrefixWord(p.Category, term):
+			rank += categoryWeight
+		case hasPrefixWord(p.Description, term):
+			rank += descriptionWeight
+		default:
+			return 0
+		}
+	}
+	return rank
+}
+
+func hasPrefixWord(text, term string) bool {
+	for _, word := range store.SearchTerms(text) {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchResult builds a result with HTML-escaped highlights marking words that start with a term
+func (s *ProductStore) searchResult(p models.Product, rank float64, terms []string) models.ProductSearchResult {
+	sellerName := "Unknown Seller"
+	if u, ok := s.d.users[p.SellerID]; ok {
+		sellerName = u.Name
+	}
+	return models.ProductSearchResult{
+		ProductWithSeller: models.ProductWithSeller{
+			ID: p.ID, Name: p.Name, Description: p.Description, Price: p.Price, Stock: p.Stock,
+			Category: p.Category, ImageURL: p.ImageURL, SellerID: p.SellerID, SellerName: sellerName, CreatedAt: p.CreatedAt,
+		},
+		Rank:          rank,
+		NameHighlight: highlight(p.Name, terms),
+		Snippet:       highlight(p.Description, terms),
+	}
+}
+
+func highlight(text string, terms []string) string {
+	words := strings.Fields(text)
+	for i, word := range words {
+		marked := false
+		for _, w := range store.SearchTerms(word) {
+			for _, term := range terms {
+				marked = marked || strings.HasPrefix(w, term)
+			}
+		}
+		words[i] = html.EscapeString(word)
+		if marked {
+			words[i] = "<mark>" + words[i] + "</mark>"
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// nameSimilarity is the average, over the terms, of the best share of a term's trigrams found in one word of the name
+func nameSimilarity(name string, terms []string) float64 {
+	words := store.SearchTerms(name)
+	total := 0.0
+	for _, term := range terms {
+		want := trigrams(term)
+		best := 0.0
+		for _, word := range words {
+			have := trigrams(word)
+			found := 0
+			for t := range want {
+				if have[t] {
+					found++
+				}
+			}
+			if share := float64(found) / float64(len(want)); share > best {
+				best = share
+			}
+		}
+		total += best
+	}
+	return total / float64(len(terms))
+}
+
+// trigrams returns the trigrams of a word padded the way pg_trgm pads it
+func trigrams(word string) map[string]bool {
+	padded := []rune("  " + word + " ")
+	set := map[string]bool{}
+	for i := 0; i+3 <= len(padded); i++ {
+		set[string(padded[i:i+3])] = true
+	}
+	return set
+}
+
+// Suggest lists products, categories and sellers whose names contain text, those starting with it first
+func (s *ProductStore) Suggest(ctx context.Context, text string, limit int) (models.Suggestions, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	suggestions := models.Suggestions{
+		Products:   []models.ProductSuggestion{},
+		Categories: []models.CategorySuggestion{},
+		Sellers:    []models.SellerSuggestion{},
+	}
+	text = strings.ToLower(text)
+	// before orders names starting with text ahead of the others, then alphabetically
+	before := func(a, b string) bool {
+		pa, pb := strings.HasPrefix(strings.ToLower(a), text), strings.HasPrefix(strings.ToLower(b), text)
+		if pa != pb {
+			return pa
+		}
+		return a < b
+	}
+
+	hasProducts := map[int]bool{}
+	for _, id := range sortedIDs(s.d.products) {
+		p := s.d.products[id]
+		if !s.d.listed(p) {
+			continue
+		}
+		hasProducts[p.SellerID] = true
+		if strings.Contains(strings.ToLower(p.Name), text) {
+			suggestions.Products = append(suggestions.Products, models.ProductSuggestion{ID: p.ID, Name: p.Name})
+		}
+	}
+	for _, id := range sortedIDs(s.d.categories) {
+		c := s.d.categories[id]
+		if !strings.Contains(strings.ToLower(c.Name), text) {
+			continue
+		}
+		// Count the products of the subcategories too, like the catalog filter does
+		subtree := s.d.categorySubtree([]string{c.Slug})
+		count := 0
+		for _, p := range s.d.products {
+			if subtree[p.CategoryID] && s.d.listed(p) {
+				count++
+			}
+		}
+		if count > 0 {
+			suggestions.Categories = append(suggestions.Categories, models.CategorySuggestion{Name: c.Name, Slug: c.Slug, ProductCount: count})
+		}
+	}
+	for _, id := range sortedIDs(s.d.users) {
+		u := s.d.users[id]
+		if u.Role == models.RoleSeller && hasProducts[u.ID] && strings.Contains(strings.ToLower(u.Name), text) {
+			suggestions.Sellers = append(suggestions.Sellers, models.SellerSuggestion{ID: u.ID, Name: u.Name})
+		}
+	}
+
+	sort.SliceStable(suggestions.Products, func(i, j int) bool {
+		return before(suggestions.Products[i].Name, suggestions.Products[j].Name)
+	})
+	sort.SliceStable(suggestions.Categories, func(i, j int) bool {
+		return before(suggestions.Categories[i].Name, suggestions.Categories[j].Name)
+	})
+	sort.SliceStable(suggestions.Sellers, func(i, j int) bool {
+		return before(suggestions.Sellers[i].Name, suggestions.Sellers[j].Name)
+	})
+	suggestions.Products = suggestions.Products[:min(limit, len(suggestions.Products))]
+	suggestions.Categories = suggestions.Categories[:min(limit, len(suggestions.Categories))]
+	suggestions.Sellers = suggestions.Sellers[:min(limit, len(suggestions.Sellers))]
+	return suggestions, nil
+}
+
+// RecordSearchMiss counts a search that found nothing against today's entry for the query
+func (s *ProductStore) RecordSearchMiss(ctx context.Context, query string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if query == "" {
+		return store.ErrInvalid
+	}
+	y, m, d := time.Now().Date()
+	s.d.searchMisses[searchMissKey{query, time.Date(y, m, d, 0, 0, 0, 0, time.UTC)}]++
+	return nil
+}
+
+// ListSearchMisses returns the most searched queries that found nothing since the given day
+func (s *ProductStore) ListSearchMisses(ctx context.Context, since time.Time, limit int) ([]models.SearchMiss, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	byQuery := map[string]*models.SearchMiss{}
+	for key, searches := range s.d.searchMisses {
+		if key.day.Before(since) {
+			continue
+		}
+		m, ok := byQuery[key.query]
+		if !ok {
+			m = &models.SearchMiss{Query: key.query}
+			byQuery[key.query] = m
+		}
+		m.Searches += searches
+		if key.day.After(m.LastSearched) {
+			m.LastSearched = key.day
+		}
+	}
+
+	var misses []models.SearchMiss
+	for _, m := range byQuery {
+		misses = append(misses, *m)
+	}
+	sort.Slice(misses, func(i, j int) bool {
+		if misses[i].Searches != misses[j].Searches {
+			return misses[i].Searches > misses[j].Searches
+		}
+		return misses[i].Query < misses[j].Query
+	})
+	return misses[:min(limit, len(misses))], nil
+}
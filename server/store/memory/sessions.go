@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/rythmokay/golang/server/store"
+)
+
+// SessionStore is the in-memory implementation of store.SessionStore
+type SessionStore struct {
+	d *data
+}
+
+type refreshToken struct {
+	store.RefreshToken
+	revoked bool
+}
+
+// CreateRefreshToken stores a refresh token
+func (s *SessionStore) CreateRefreshToken(ctx context.Context, t store.RefreshToken) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[t.UserID]; !ok {
+		return store.ErrInvalid
+	}
+	s.d.refreshTokens[s.d.id()] = refreshToken{RefreshToken: t}
+	return nil
+}
+
+// RotateRefreshToken replaces a refresh token with a new one in the same family
+func (s *SessionStore) RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (store.Session, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for id, t := range s.d.refreshTokens {
+		if t.TokenHash != oldHash {
+			continue
+		}
+		session := store.Session{UserID: t.UserID, Role: s.d.users[t.UserID].Role, FamilyID: t.FamilyID}
+		if t.revoked {
+			s.d.revokeSessions(func(other refreshToken) bool { return other.FamilyID == t.FamilyID })
+			return session, store.ErrTokenReused
+		}
+		if time.Now().After(t.ExpiresAt) {
+			return session, store.ErrTokenExpired
+		}
+		t.revoked = true
+		s.d.refreshTokens[id] = t
+		s.d.refreshTokens[s.d.id()] = refreshToken{RefreshToken: store.RefreshToken{
+			UserID: t.UserID, FamilyID: t.FamilyID, TokenHash: newHash, ExpiresAt: expiresAt,
+		}}
+		return session, nil
+	}
+	return store.Session{}, store.ErrNotFound
+}
+
+// revokeSessions revokes the refresh tokens that match
+func (d *data) revokeSessions(match func(t refreshToken) bool) {
+	for id, t := range d.refreshTokens {
+		if match(t) {
+			t.revoked = true
+			d.refreshTokens[id] = t
+		}
+	}
+}
+
+// RevokeSession revokes the family of one of the user's refresh tokens
+func (s *SessionStore) RevokeSession(ctx context.Context, userID int, tokenHash string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, t := range s.d.refreshTokens {
+		if t.TokenHash == tokenHash && t.UserID == userID {
+			s.d.revokeSessions(func(other refreshToken) bool { return other.FamilyID == t.FamilyID })
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+// RevokeUserSessions revokes every token family of the user but one
+func (s *SessionStore) RevokeUserSessions(ctx context.Context, userID int, keepFamilyID string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	s.d.revokeSessions(func(t refreshToken) bool { return t.UserID == userID && t.FamilyID != keepFamilyID })
+	return nil
+}
+
+// SessionActive reports whether the family still has a token that has not been revoked
+func (s *SessionStore) SessionActive(ctx context.Context, userID int, familyID string) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, t := range s.d.refreshTokens {
+		if t.UserID == userID && t.FamilyID == familyID && !t.revoked {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/rythmokay/golang/server/store"
+)
+
+// ThrottleStore is the in-memory implementation of store.ThrottleStore
+type ThrottleStore struct {
+	d *data
+}
+
+type throttle struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
+
+// LockedUntil returns the latest lockout still in force for any of the keys
+func (s *ThrottleStore) LockedUntil(ctx context.Context, keys ...store.ThrottleKey) (time.Time, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var latest time.Time
+	for _, k := range keys {
+		if t := s.d.throttles[k]; t.lockedUntil.After(time.Now()) && t.lockedUntil.After(latest) {
+			latest = t.lockedUntil
+		}
+	}
+	return latest, nil
+}
+
+// RecordFailure counts a failed login; failures older than window no longer count towards a lockout
+func (s *ThrottleStore) RecordFailure(ctx context.Context, key store.ThrottleKey, window time.Duration) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	t, ok := s.d.throttles[key]
+	now := time.Now()
+	if !ok || t.lastFailureAt.Before(now.Add(-window)) {
+		t.failures = 1
+	} else {
+		t.failures++
+	}
+	t.lastFailureAt = now
+	s.d.throttles[key] = t
+	return t.failures, nil
+}
+
+// Lock refuses logins for the key until the given time
+func (s *ThrottleStore) Lock(ctx context.Context, key store.ThrottleKey, until time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if t, ok := s.d.throttles[key]; ok {
+		t.lockedUntil = until
+		s.d.throttles[key] = t
+	}
+	return nil
+}
+
+// Clear forgets the failures counted against the key
+func (s *ThrottleStore) Clear(ctx context.Context, key store.ThrottleKey) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	delete(s.d.throttles, key)
+	return nil
+}
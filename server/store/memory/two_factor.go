@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/rythmokay/golang/server/store"
+)
+
+// TwoFactorStore is the in-memory implementation of store.TwoFactorStore
+type TwoFactorStore struct {
+	d *data
+}
+
+// totpState is a user's TOTP enrollment, kept alongside the user like the totp_* columns
+type totpState struct {
+	secret   string
+	lastStep *int64
+}
+
+type recoveryCode struct {
+	userID   int
+	codeHash string
+	used     bool
+}
+
+type challenge struct {
+	userID    int
+	tokenHash string
+	expiresAt time.Time
+	used      bool
+	attempts  int
+}
+
+// SetTOTPSecret stores a secret for an unconfirmed enrollment
+func (s *TwoFactorStore) SetTOTPSecret(ctx context.Context, userID int, secret string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return store.ErrNotFound
+	}
+	s.d.totp[userID] = totpState{secret: secret}
+	return nil
+}
+
+// GetTOTPSecret returns the user's secret, or "" before enrollment starts
+func (s *TwoFactorStore) GetTOTPSecret(ctx context.Context, userID int) (string, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return "", store.ErrNotFound
+	}
+	return s.d.totp[userID].secret, nil
+}
+
+// EnableTwoFactor confirms the enrollment and replaces the recovery codes
+func (s *TwoFactorStore) EnableTwoFactor(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[userID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	u.TwoFactorEnabled = true
+	s.d.users[userID] = u
+	state := s.d.totp[userID]
+	state.lastStep = &step
+	s.d.totp[userID] = state
+
+	for id, c := range s.d.recoveryCodes {
+		if c.userID == userID {
+			delete(s.d.recoveryCodes, id)
+		}
+	}
+	for _, hash := range recoveryCodeHashes {
+		s.d.recoveryCodes[s.d.id()] = recoveryCode{userID: userID, codeHash: hash}
+	}
+	return nil
+}
+
+// CreateChallenge stores a login challenge
+func (s *TwoFactorStore) CreateChallenge(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return store.ErrInvalid
+	}
+	s.d.challenges[s.d.id()] = challenge{userID: userID, tokenHash: tokenHash, expiresAt: expiresAt}
+	return nil
+}
+
+// GetChallenge looks up a challenge that can still be completed, with its user
+func (s *TwoFactorStore) GetChallenge(ctx context.Context, tokenHash string, maxAttempts int) (store.TwoFactorChallenge, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for id, c := range s.d.challenges {
+		if c.tokenHash != tokenHash || c.used || !time.Now().Before(c.expiresAt) || c.attempts >= maxAttempts {
+			continue
+		}
+		state := s.d.totp[c.userID]
+		return store.TwoFactorChallenge{ID: id, User: s.d.users[c.userID], Secret: state.secret, LastStep: state.lastStep}, nil
+	}
+	return store.TwoFactorChallenge{}, store.ErrNotFound
+}
+
+// CompleteChallengeWithCode uses up the challenge and records the code's time step so it cannot be replayed
+func (s *TwoFactorStore) CompleteChallengeWithCode(ctx context.Context, challengeID, userID int, step int64) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	c, ok := s.d.challenges[challengeID]
+	if !ok || c.used {
+		return store.ErrNotFound
+	}
+	state := s.d.totp[userID]
+	if state.lastStep != nil && step <= *state.lastStep {
+		return store.ErrInvalidCode
+	}
+	state.lastStep = &step
+	s.d.totp[userID] = state
+	c.used = true
+	s.d.challenges[challengeID] = c
+	return nil
+}
+
+// CompleteChallengeWithRecoveryCode uses up the challenge and the recovery code
+func (s *TwoFactorStore) CompleteChallengeWithRecoveryCode(ctx context.Context, challengeID, userID int, codeHash string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	c, ok := s.d.challenges[challengeID]
+	if !ok || c.used {
+		return store.ErrNotFound
+	}
+	for id, code := range s.d.recoveryCodes {
+		if code.userID == userID && code.codeHash == codeHash && !code.used {
+			code.used = true
+			s.d.recoveryCodes[id] = code
+			c.used = true
+			s.d.challenges[challengeID] = c
+			return nil
+		}
+	}
+	return store.ErrInvalidCode
+}
+
+// FailChallenge counts a wrong code against the challenge
+func (s *TwoFactorStore) FailChallenge(ctx context.Context, challengeID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if c, ok := s.d.challenges[challengeID]; ok {
+		c.attempts++
+		s.d.challenges[challengeID] = c
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// UserStore is the in-memory implementation of store.UserStore
+type UserStore struct {
+	d *data
+}
+
+// CreateUser inserts a new user
+func (s *UserStore) CreateUser(ctx context.Context, u *models.User) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if blank(u.Name) || blank(u.Email) {
+		return store.ErrInvalid
+	}
+	for _, existing := range s.d.users {
+		if existing.Email == u.Email {
+			return store.ErrEmailTaken
+		}
+	}
+	u.ID = s.d.id()
+	s.d.users[u.ID] = *u
+	return nil
+}
+
+// GetUserByID looks up a user by id
+func (s *UserStore) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok {
+		return models.User{}, store.ErrNotFound
+	}
+	return u, nil
+}
+
+// GetUserByEmail looks up a user by email address
+func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, u := range s.d.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return models.User{}, store.ErrNotFound
+}
+
+// AccountActive reports whether the user exists and has not been deleted
+func (s *UserStore) AccountActive(ctx context.Context, id int) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	_, ok := s.d.users[id]
+	return ok && !s.d.deletedUsers[id], nil
+}
+
+// UpdateProfile changes the editable profile fields
+func (s *UserStore) UpdateProfile(ctx context.Context, id int, name, address, phoneNumber string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if blank(name) {
+		return store.ErrInvalid
+	}
+	u.Name, u.Address, u.PhoneNumber = name, address, phoneNumber
+	s.d.users[id] = u
+	return nil
+}
+
+// GetSellerProfile looks up a seller with the number of products they list.
+// Users kept in memory have no signup time, so MemberSince is left unset.
+func (s *UserStore) GetSellerProfile(ctx context.Context, id int) (models.SellerProfile, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok || u.Role != models.RoleSeller {
+		return models.SellerProfile{}, store.ErrNotFound
+	}
+	profile := models.SellerProfile{ID: u.ID, Name: u.Name}
+	for _, p := range s.d.products {
+		if p.SellerID == id && s.d.listed(p) {
+			profile.ProductCount++
+		}
+	}
+	return profile, nil
+}
+
+// SetRole changes the role of an active user
+func (s *UserStore) SetRole(ctx context.Context, id int, role string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok || s.d.deletedUsers[id] {
+		return store.ErrNotFound
+	}
+	u.Role = role
+	s.d.users[id] = u
+	return nil
+}
+
+// SetPassword replaces the password hash and revokes the user's other sessions
+func (s *UserStore) SetPassword(ctx context.Context, id int, passwordHash, keepFamilyID string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	u.Password = passwordHash
+	s.d.users[id] = u
+	s.d.revokeSessions(func(t refreshToken) bool { return t.UserID == id && t.FamilyID != keepFamilyID })
+	return nil
+}
+
+// ExportUserData gathers the user's profile, addresses, cart and orders, and the products of a seller.
+// Users kept in memory have no signup time, so CreatedAt is left unset.
+func (s *UserStore) ExportUserData(ctx context.Context, id int) (models.UserDataExport, error) {
+	export := models.UserDataExport{
+		ExportedAt: time.Now(),
+		Addresses:  []string{},
+		Cart:       []models.CartItemWithProduct{},
+		Orders:     []models.OrderWithItemDetails{},
+	}
+
+	u, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return export, err
+	}
+	u.Password = ""
+	export.Profile = u
+
+	cart, err := (&CartStore{s.d}).ListCartItems(ctx, id)
+	if err != nil {
+		return export, err
+	}
+	export.Cart = append(export.Cart, cart...)
+
+	orders := &OrderStore{s.d}
+	placed, err := orders.ListUserOrders(ctx, id)
+	if err != nil {
+		return export, err
+	}
+	// Addresses are the profile address plus every address an order was shipped to
+	addresses := map[string]bool{}
+	if u.Address != "" {
+		addresses[u.Address] = true
+	}
+	for _, o := range placed {
+		items, err := orders.ListOrderItems(ctx, o.ID, 0)
+		if err != nil {
+			return export, err
+		}
+		export.Orders = append(export.Orders, models.OrderWithItemDetails{Order: o, OrderItems: items, UserName: u.Name})
+		addresses[o.ShippingAddress] = true
+	}
+	for address := range addresses {
+		export.Addresses = append(export.Addresses, address)
+	}
+	sort.Strings(export.Addresses)
+
+	if u.Role == models.RoleSeller {
+		if export.Products, err = (&ProductStore{s.d}).ListSellerProducts(ctx, id); err != nil {
+			return export, err
+		}
+	}
+	return export, nil
+}
+
+// DeleteAccount anonymizes a user and removes their sessions, credentials, cart and throttles
+func (s *UserStore) DeleteAccount(ctx context.Context, id int, passwordHash string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u, ok := s.d.users[id]
+	if !ok || s.d.deletedUsers[id] {
+		return store.ErrNotFound
+	}
+	oldEmail := u.Email
+	s.d.users[id] = models.User{
+		ID:       id,
+		Name:     "Deleted user",
+		Email:    fmt.Sprintf("deleted-user-%d@deleted.invalid", id),
+		Password: passwordHash,
+		Role:     u.Role,
+	}
+	s.d.deletedUsers[id] = true
+
+	for itemID, item := range s.d.cartItems {
+		if item.UserID == id || s.d.products[item.ProductID].SellerID == id {
+			delete(s.d.cartItems, itemID)
+		}
+	}
+	deleteWhere(s.d.refreshTokens, func(t refreshToken) bool { return t.UserID == id })
+	deleteWhere(s.d.passwordResets, func(t singleUseToken) bool { return t.userID == id })
+	deleteWhere(s.d.verifications, func(t singleUseToken) bool { return t.userID == id })
+	deleteWhere(s.d.recoveryCodes, func(c recoveryCode) bool { return c.userID == id })
+	deleteWhere(s.d.challenges, func(c challenge) bool { return c.userID == id })
+	delete(s.d.totp, id)
+	delete(s.d.throttles, store.ThrottleKey{Scope: store.ThrottleScopeAccount, Key: strings.ToLower(strings.TrimSpace(oldEmail))})
+	for i, e := range s.d.auditLog {
+		if e.Email == oldEmail {
+			s.d.auditLog[i].Email = ""
+		}
+	}
+
+	// Finished orders no longer need contact details; open ones keep them so sellers can deliver
+	for orderID, o := range s.d.orders {
+		if o.UserID == id && (o.Status == "delivered" || o.Status == "cancelled") {
+			o.ShippingAddress, o.ContactNumber = "[redacted]", "[redacted]"
+			s.d.orders[orderID] = o
+		}
+	}
+	// A deleted seller's listings stay for order history but leave the storefront and can no longer be bought
+	for productID, p := range s.d.products {
+		if p.SellerID == id {
+			p.Stock = 0
+			s.d.products[productID] = p
+			s.d.unlistedProducts[productID] = true
+		}
+	}
+	return nil
+}
+
+// deleteWhere removes the entries of m that match
+func deleteWhere[T any](m map[int]T, match func(T) bool) {
+	for id, v := range m {
+		if match(v) {
+			delete(m, id)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/rythmokay/golang/server/store"
+)
+
+// VerificationStore is the in-memory implementation of store.VerificationStore
+type VerificationStore struct {
+	d *data
+}
+
+// CreateEmailVerification stores a verification token for the given address
+func (s *VerificationStore) CreateEmailVerification(ctx context.Context, userID int, email, tokenHash string, expiresAt time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.users[userID]; !ok {
+		return store.ErrInvalid
+	}
+	s.d.verifications[s.d.id()] = singleUseToken{
+		userID: userID, email: email, tokenHash: tokenHash, expiresAt: expiresAt, createdAt: time.Now(),
+	}
+	return nil
+}
+
+// RetireEmailVerifications uses up the user's outstanding tokens
+func (s *VerificationStore) RetireEmailVerifications(ctx context.Context, userID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for id, t := range s.d.verifications {
+		if t.userID == userID {
+			t.used = true
+			s.d.verifications[id] = t
+		}
+	}
+	return nil
+}
+
+// VerifyEmail uses up a token and makes its address the user's verified email
+func (s *VerificationStore) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, t := range s.d.verifications {
+		if t.tokenHash != tokenHash || !t.usable() {
+			continue
+		}
+		for id, other := range s.d.users {
+			if id != t.userID && other.Email == t.email {
+				return t.userID, store.ErrEmailTaken
+			}
+		}
+
+		u := s.d.users[t.userID]
+		u.Email, u.EmailVerified = t.email, true
+		s.d.users[t.userID] = u
+
+		// Retire this token and any others outstanding for the same address
+		for id, other := range s.d.verifications {
+			if other.userID == t.userID && (other.tokenHash == tokenHash || other.email == t.email) {
+				other.used = true
+				s.d.verifications[id] = other
+			}
+		}
+		return t.userID, nil
+	}
+	return 0, store.ErrNotFound
+}
+
+// PendingEmailVerification returns the address of the user's latest outstanding token
+func (s *VerificationStore) PendingEmailVerification(ctx context.Context, userID int) (string, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var latest *singleUseToken
+	for _, id := range sortedIDs(s.d.verifications) {
+		if t := s.d.verifications[id]; t.userID == userID && t.usable() {
+			latest = &t
+		}
+	}
+	if latest == nil {
+		return "", store.ErrNotFound
+	}
+	return latest.email, nil
+}
+
+// ListEmailVerificationTimes returns when tokens were issued to the user since the given time
+func (s *VerificationStore) ListEmailVerificationTimes(ctx context.Context, userID int, since time.Time) ([]time.Time, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var times []time.Time
+	for _, t := range s.d.verifications {
+		if t.userID == userID && t.createdAt.After(since) {
+			times = append(times, t.createdAt)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times, nil
+}
@@ -0,0 +1,30 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/rythmokay/golang/server/store"
+)
+
+// AuditStore is the Postgres implementation of store.AuditStore
+type AuditStore struct {
+	db *sql.DB
+}
+
+// RecordEvent writes an event to auth_audit_log
+func (s *AuditStore) RecordEvent(ctx context.Context, e store.AuthEvent) error {
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	details, err := json.Marshal(e.Details)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO auth_audit_log (event, email, ip_address, details)
+		VALUES ($1, $2, $3, $4)
+	`, e.Event, e.Email, e.IP, string(details))
+	return err
+}
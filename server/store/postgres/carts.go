@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rythmokay/golang/server/models"
+)
+
+// CartStore is the Postgres implementation of store.CartStore
+type CartStore struct {
+	db *sql.DB
+}
+
+// AddCartItem adds a product to a cart or increases its quantity
+func (s *CartStore) AddCartItem(ctx context.Context, userID, productID, quantity int) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO cart_items (user_id, product_id, quantity)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, product_id)
+		DO UPDATE SET quantity = cart_items.quantity + $3
+	`, userID, productID, quantity)
+	return constraintError(err)
+}
+
+// GetCartItem looks up a cart item by id
+func (s *CartStore) GetCartItem(ctx context.Context, id int) (models.CartItem, error) {
+	var item models.CartItem
+	err := s.db.QueryRowContext(ctx, "SELECT id, user_id, product_id, quantity FROM cart_items WHERE id = $1", id).
+		Scan(&item.ID, &item.UserID, &item.ProductID, &item.Quantity)
+	return item, notFound(err)
+}
+
+// ListCartItems returns a user's cart with product details
+func (s *CartStore) ListCartItems(ctx context.Context, userID int) ([]models.CartItemWithProduct, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.id, c.quantity, p.id, p.name, p.price, COALESCE(p.image_url, '')
+		FROM cart_items c
+		JOIN products p ON c.product_id = p.id
+		WHERE c.user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.CartItemWithProduct
+	for rows.Next() {
+		var item models.CartItemWithProduct
+		if err := rows.Scan(&item.ID, &item.Quantity, &item.Product.ID, &item.Product.Name, &item.Product.Price, &item.Product.ImageURL); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// UpdateCartItemQuantity sets the quantity of a user's cart item
+func (s *CartStore) UpdateCartItemQuantity(ctx context.Context, id, userID, quantity int) error {
+	return requireRow(s.db.ExecContext(ctx,
+		"UPDATE cart_items SET quantity = $1 WHERE id = $2 AND user_id = $3", quantity, id, userID))
+}
+
+// DeleteCartItem removes a user's cart item
+func (s *CartStore) DeleteCartItem(ctx context.Context, id, userID int) error {
+	return requireRow(s.db.ExecContext(ctx, "DELETE FROM cart_items WHERE id = $1 AND user_id = $2", id, userID))
+}
@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/rythmokay/golang/server/database"
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// CategoryStore is the Postgres implementation of store.CategoryStore
+type CategoryStore struct {
+	db *sql.DB
+}
+
+const categoryColumns = `c.id, c.parent_id, c.name, c.slug, c.position,
+	(SELECT COUNT(*) FROM products p WHERE p.category_id = c.id AND p.unlisted_at IS NULL)`
+
+func scanCategory(row scanner) (models.Category, error) {
+	var c models.Category
+	var parentID sql.NullInt64
+	err := row.Scan(&c.ID, &parentID, &c.Name, &c.Slug, &c.Position, &c.ProductCount)
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		c.ParentID = &id
+	}
+	return c, notFound(err)
+}
+
+// categoryError translates a duplicate slug or sibling name into store.ErrCategoryExists
+func categoryError(err error) error {
+	if database.IsUniqueViolation(err) {
+		return fmt.Errorf("%w: %w", store.ErrCategoryExists, err)
+	}
+	return constraintError(err)
+}
+
+// ListCategories returns every category with the number of products filed directly under it
+func (s *CategoryStore) ListCategories(ctx context.Context) ([]models.Category, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+categoryColumns+" FROM categories c ORDER BY c.position, c.name, c.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// GetCategory looks up a category by id
+func (s *CategoryStore) GetCategory(ctx context.Context, id int) (models.Category, error) {
+	return scanCategory(s.db.QueryRowContext(ctx, "SELECT "+categoryColumns+" FROM categories c WHERE c.id = $1", id))
+}
+
+// GetCategoryBySlug looks up a category by slug
+func (s *CategoryStore) GetCategoryBySlug(ctx context.Context, slug string) (models.Category, error) {
+	return scanCategory(s.db.QueryRowContext(ctx, "SELECT "+categoryColumns+" FROM categories c WHERE c.slug = $1", slug))
+}
+
+// CreateCategory inserts a new category
+func (s *CategoryStore) CreateCategory(ctx context.Context, c *models.Category) error {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO categories (parent_id, name, slug, position)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, c.ParentID, c.Name, c.Slug, c.Position).Scan(&c.ID)
+	return categoryError(err)
+}
+
+// UpdateCategory saves a category and copies its name onto its products, all or nothing.
+// Moves are serialized with a table lock so two concurrent moves cannot close a loop between them.
+func (s *CategoryStore) UpdateCategory(ctx context.Context, c *models.Category) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+
+	if c.ParentID != nil {
+		// Walk up from the new parent; meeting the category itself means the move would make a loop
+		var cycle bool
+		err := tx.QueryRowContext(ctx, `
+			WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id FROM categories WHERE id = $1
+				UNION ALL
+				SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+			)
+			SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)
+		`, *c.ParentID, c.ID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return store.ErrCategoryCycle
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE categories
+		SET parent_id = $1, name = $2, slug = $3, position = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+	`, c.ParentID, c.Name, c.Slug, c.Position, c.ID)
+	if err != nil {
+		return categoryError(err)
+	}
+	if err := requireRow(result, nil); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE products SET category = $1 WHERE category_id = $2 AND category <> $1", c.Name, c.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteCategory removes a category that nothing refers to
+func (s *CategoryStore) DeleteCategory(ctx context.Context, id int) error {
+	err := requireRow(s.db.ExecContext(ctx, "DELETE FROM categories WHERE id = $1", id))
+	if database.IsForeignKeyViolation(err) {
+		return fmt.Errorf("%w: %w", store.ErrCategoryInUse, err)
+	}
+	return err
+}
+
+// categorySubtree returns a condition keeping products filed under the categories whose slugs are in the
+// array parameter slugs, or under any of their subcategories
+func categorySubtree(slugs string) string {
+	return `p.category_id IN (
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE slug = ANY(` + slugs + `)
+			UNION
+			SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+		)
+		SELECT id FROM subtree
+	)`
+}
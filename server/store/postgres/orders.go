@@ -0,0 +1,214 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// OrderStore is the Postgres implementation of store.OrderStore
+type OrderStore struct {
+	db *sql.DB
+}
+
+const orderColumns = `o.id, o.user_id, o.total_amount, o.status, o.payment_method, COALESCE(o.payment_id, ''),
+	o.shipping_address, o.contact_number, o.created_at, o.updated_at`
+
+// scanOrder scans orderColumns followed by any extra destinations
+func scanOrder(row scanner, extra ...interface{}) (models.ExtendedOrder, error) {
+	var o models.ExtendedOrder
+	dest := append([]interface{}{
+		&o.ID, &o.UserID, &o.TotalAmount, &o.Status, &o.PaymentMethod, &o.PaymentID,
+		&o.ShippingAddress, &o.ContactNumber, &o.CreatedAt, &o.UpdatedAt,
+	}, extra...)
+	return o, notFound(row.Scan(dest...))
+}
+
+// Checkout places an order for everything in the user's cart
+func (s *OrderStore) Checkout(ctx context.Context, userID int, req models.CheckoutRequest, status string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	// Lock the products so concurrent checkouts cannot oversell them. Locking in id order means two carts
+	// sharing products wait on each other instead of deadlocking.
+	rows, err := tx.QueryContext(ctx, `
+		SELECT c.product_id, c.quantity, p.price, p.stock
+		FROM cart_items c
+		JOIN products p ON c.product_id = p.id
+		WHERE c.user_id = $1
+		ORDER BY p.id
+		FOR UPDATE OF p
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	type cartLine struct {
+		productID, quantity, stock int
+		price                      float64
+	}
+	var lines []cartLine
+	totalAmount := 0.0
+	for rows.Next() {
+		var l cartLine
+		if err := rows.Scan(&l.productID, &l.quantity, &l.price, &l.stock); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if l.stock < l.quantity {
+			rows.Close()
+			return 0, &store.InsufficientStockError{ProductID: l.productID}
+		}
+		lines = append(lines, l)
+		totalAmount += l.price * float64(l.quantity)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(lines) == 0 {
+		return 0, store.ErrEmptyCart
+	}
+
+	now := time.Now()
+	var orderID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO orders (user_id, total_amount, status, payment_method, payment_id, shipping_address, contact_number, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, userID, totalAmount, status, req.PaymentMethod, req.PaymentID, req.ShippingAddress, req.ContactNumber, now, now).Scan(&orderID)
+	if err != nil {
+		return 0, constraintError(err)
+	}
+
+	for _, l := range lines {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO order_items (order_id, product_id, quantity, price, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, orderID, l.productID, l.quantity, l.price, now)
+		if err != nil {
+			return 0, constraintError(err)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE products SET stock = stock - $1, units_sold = units_sold + $1 WHERE id = $2", l.quantity, l.productID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM cart_items WHERE user_id = $1", userID); err != nil {
+		return 0, err
+	}
+
+	return orderID, tx.Commit()
+}
+
+// GetOrder looks up an order by id
+func (s *OrderStore) GetOrder(ctx context.Context, id int) (models.ExtendedOrder, error) {
+	return scanOrder(s.db.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders o WHERE o.id = $1", id))
+}
+
+// ListUserOrders returns a customer's orders, newest first
+func (s *OrderStore) ListUserOrders(ctx context.Context, userID int) ([]models.ExtendedOrder, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+orderColumns+" FROM orders o WHERE o.user_id = $1 ORDER BY o.created_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.ExtendedOrder
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// ListSellerOrders returns the orders containing a seller's products, newest first
+func (s *OrderStore) ListSellerOrders(ctx context.Context, sellerID int) ([]models.SellerOrder, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+orderColumns+`, u.name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		WHERE EXISTS (
+			SELECT 1 FROM order_items oi
+			JOIN products p ON oi.product_id = p.id
+			WHERE oi.order_id = o.id AND p.seller_id = $1
+		)
+		ORDER BY o.created_at DESC
+	`, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.SellerOrder
+	for rows.Next() {
+		var order models.SellerOrder
+		order.ExtendedOrder, err = scanOrder(rows, &order.UserName)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+// ListOrderItems returns an order's items with product details
+func (s *OrderStore) ListOrderItems(ctx context.Context, orderID, sellerID int) ([]models.OrderItemWithDetails, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT oi.id, oi.order_id, oi.product_id, p.seller_id, oi.quantity, oi.price, oi.created_at,
+		       p.name, COALESCE(p.image_url, '')
+		FROM order_items oi
+		JOIN products p ON oi.product_id = p.id
+		WHERE oi.order_id = $1 AND ($2 = 0 OR p.seller_id = $2)
+		ORDER BY oi.id
+	`, orderID, sellerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.OrderItemWithDetails
+	for rows.Next() {
+		var item models.OrderItemWithDetails
+		err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.SellerID, &item.Quantity,
+			&item.Price, &item.CreatedAt, &item.ProductName, &item.ProductImage)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// SellerHasItems reports whether an order exists and contains a seller's products
+func (s *OrderStore) SellerHasItems(ctx context.Context, orderID, sellerID int) (bool, bool, error) {
+	var orderExists, hasItems bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM orders WHERE id = $1),
+			EXISTS(
+				SELECT 1 FROM order_items oi
+				JOIN products p ON oi.product_id = p.id
+				WHERE oi.order_id = $1 AND p.seller_id = $2
+			)
+	`, orderID, sellerID).Scan(&orderExists, &hasItems)
+	return orderExists, hasItems, err
+}
+
+// UpdateOrderStatus changes the status of an order
+func (s *OrderStore) UpdateOrderStatus(ctx context.Context, orderID int, status string) error {
+	return requireRow(s.db.ExecContext(ctx,
+		"UPDATE orders SET status = $1, updated_at = $2 WHERE id = $3", status, time.Now(), orderID))
+}
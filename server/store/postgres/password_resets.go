@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PasswordResetStore is the Postgres implementation of store.PasswordResetStore
+type PasswordResetStore struct {
+	db *sql.DB
+}
+
+// CreatePasswordReset stores a reset token and retires the user's earlier ones
+func (s *PasswordResetStore) CreatePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE password_reset_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND used_at IS NULL
+	`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResetPassword uses up a reset token, sets the new password and signs the user out everywhere
+func (s *PasswordResetStore) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	// Claim the token; the row lock keeps it single-use under concurrent requests
+	var tokenID, userID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id
+		FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		FOR UPDATE
+	`, tokenHash).Scan(&tokenID, &userID)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET password = $1 WHERE id = $2", passwordHash, userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1", tokenID); err != nil {
+		return 0, err
+	}
+	if err := revokeUserSessions(ctx, tx, userID, ""); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
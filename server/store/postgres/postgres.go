@@ -0,0 +1,65 @@
+// Package postgres implements the store interfaces on top of the Postgres schema managed by the migrations
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/rythmokay/golang/server/database"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// NewStores returns Postgres-backed stores sharing the connection pool db
+func NewStores(db *sql.DB) store.Stores {
+	return store.Stores{
+		Users:      &UserStore{db: db},
+		Products:   &ProductStore{db: db},
+		Categories: &CategoryStore{db: db},
+		Carts:      &CartStore{db: db},
+		Orders:     &OrderStore{db: db},
+
+		Sessions:       &SessionStore{db: db},
+		PasswordResets: &PasswordResetStore{db: db},
+		Verifications:  &VerificationStore{db: db},
+		TwoFactor:      &TwoFactorStore{db: db},
+		Throttles:      &ThrottleStore{db: db},
+		Audit:          &AuditStore{db: db},
+	}
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// notFound translates sql.ErrNoRows into store.ErrNotFound
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+// constraintError translates constraint violations into the matching store errors.
+// The Postgres error stays in the chain so callers can tell which constraint failed.
+func constraintError(err error) error {
+	if database.IsCheckViolation(err) {
+		return fmt.Errorf("%w: %w", store.ErrInvalid, err)
+	}
+	return err
+}
+
+// requireRow returns store.ErrNotFound when a write matched no rows
+func requireRow(result sql.Result, err error) error {
+	if err != nil {
+		return constraintError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/rythmokay/golang/server/database"
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// ProductStore is the Postgres implementation of store.ProductStore
+type ProductStore struct {
+	db *sql.DB
+}
+
+const productColumns = `id, seller_id, name, COALESCE(description, ''), price, stock, category_id, category, COALESCE(image_url, ''), created_at, updated_at`
+
+func scanProduct(row scanner) (models.Product, error) {
+	var p models.Product
+	err := row.Scan(&p.ID, &p.SellerID, &p.Name, &p.Description, &p.Price, &p.Stock, &p.CategoryID, &p.Category, &p.ImageURL, &p.CreatedAt, &p.UpdatedAt)
+	return p, notFound(err)
+}
+
+// CreateProduct inserts a new product, copying the name of its category onto it
+func (s *ProductStore) CreateProduct(ctx context.Context, p *models.Product) error {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO products (seller_id, name, description, price, stock, category_id, category, image_url, created_at, updated_at)
+		SELECT $1, $2, $3, $4, $5, c.id, c.name, $7, $8, $9
+		FROM categories c
+		WHERE c.id = $6
+		RETURNING id, category
+	`, p.SellerID, p.Name, p.Description, p.Price, p.Stock, p.CategoryID, p.ImageURL, p.CreatedAt, p.UpdatedAt).Scan(&p.ID, &p.Category)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: category %d does not exist", store.ErrInvalid, p.CategoryID)
+	}
+	return constraintError(err)
+}
+
+// GetProduct looks up a listed product by id
+func (s *ProductStore) GetProduct(ctx context.Context, id int) (models.Product, error) {
+	return scanProduct(s.db.QueryRowContext(ctx,
+		"SELECT "+productColumns+" FROM products WHERE id = $1 AND unlisted_at IS NULL", id))
+}
+
+// UpdateProduct saves the editable fields of a seller's product, copying the name of its category onto it
+func (s *ProductStore) UpdateProduct(ctx context.Context, p *models.Product) error {
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE products p
+		SET name = $1, description = $2, price = $3, stock = $4, category_id = c.id, category = c.name,
+		    image_url = $6, updated_at = $7
+		FROM categories c
+		WHERE c.id = $5 AND p.id = $8 AND p.seller_id = $9
+		RETURNING p.category
+	`, p.Name, p.Description, p.Price, p.Stock, p.CategoryID, p.ImageURL, p.UpdatedAt, p.ID, p.SellerID).Scan(&p.Category)
+	return constraintError(notFound(err))
+}
+
+// DeleteProduct removes a seller's product that nothing refers to
+func (s *ProductStore) DeleteProduct(ctx context.Context, id, sellerID int) error {
+	err := requireRow(s.db.ExecContext(ctx, "DELETE FROM products WHERE id = $1 AND seller_id = $2", id, sellerID))
+	if database.IsForeignKeyViolation(err) {
+		return fmt.Errorf("%w: %w", store.ErrProductInUse, err)
+	}
+	return err
+}
+
+// ListRelatedProducts ranks other products by how many orders they share with p, then by whether they are
+// in p's category, in stock and selling well
+func (s *ProductStore) ListRelatedProducts(ctx context.Context, p models.Product, limit int) ([]models.ProductWithSeller, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		WITH bought_together AS (
+			SELECT other.product_id, COUNT(DISTINCT other.order_id) AS orders
+			FROM order_items item
+			JOIN order_items other ON other.order_id = item.order_id AND other.product_id <> item.product_id
+			WHERE item.product_id = $1
+			GROUP BY other.product_id
+		)
+		SELECT p.id, p.name, COALESCE(p.description, ''), p.price, p.stock, p.category, COALESCE(p.image_url, ''),
+		       p.seller_id, COALESCE(u.name, 'Unknown Seller'), p.created_at
+		FROM products p
+		LEFT JOIN bought_together bt ON bt.product_id = p.id
+		LEFT JOIN users u ON p.seller_id = u.id
+		WHERE p.id <> $1 AND p.unlisted_at IS NULL AND (bt.product_id IS NOT NULL OR p.category_id = $2)
+		ORDER BY COALESCE(bt.orders, 0) DESC, p.category_id = $2 DESC, p.stock > 0 DESC, p.units_sold DESC, p.id
+		LIMIT $3
+	`, p.ID, p.CategoryID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []models.ProductWithSeller
+	for rows.Next() {
+		var r models.ProductWithSeller
+		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &r.Price, &r.Stock, &r.Category, &r.ImageURL,
+			&r.SellerID, &r.SellerName, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		products = append(products, r)
+	}
+	return products, rows.Err()
+}
+
+// ListSellerProducts returns a seller's products, newest first
+func (s *ProductStore) ListSellerProducts(ctx context.Context, sellerID int) ([]models.Product, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+productColumns+" FROM products WHERE seller_id = $1 ORDER BY created_at DESC", sellerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []models.Product
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// catalogSort describes how a sort order is paged: the columns compared against the cursor, the direction
+// and the cursor value for the sort key
+type catalogSort struct {
+	key   string
+	desc  bool
+	value func(c *store.ProductCursor) interface{}
+}
+
+var catalogSorts = map[store.ProductSort]catalogSort{
+	store.SortNewest:    {"p.created_at", true, func(c *store.ProductCursor) interface{} { return c.CreatedAt }},
+	store.SortPriceAsc:  {"p.price", false, func(c *store.ProductCursor) interface{} { return c.Price }},
+	store.SortPriceDesc: {"p.price", true, func(c *store.ProductCursor) interface{} { return c.Price }},
+	store.SortName:      {"p.name", false, func(c *store.ProductCursor) interface{} { return c.Name }},
+	store.SortPopular:   {"p.units_sold", true, func(c *store.ProductCursor) interface{} { return c.UnitsSold }},
+}
+
+// ListProducts returns one page of the storefront catalog with seller names.
+// Pages are read with keyset pagination: each page continues after the sort key and id of the previous
+// page's last product, so deep pages cost the same as the first one.
+func (s *ProductStore) ListProducts(ctx context.Context, q store.ProductQuery) (store.ProductPage, error) {
+	var page store.ProductPage
+	sorting, ok := catalogSorts[q.Sort]
+	if !ok {
+		return page, fmt.Errorf("unknown product sort %q", q.Sort)
+	}
+
+	where := []string{"p.unlisted_at IS NULL"}
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if len(q.Categories) > 0 {
+		where = append(where, categorySubtree(arg(pq.Array(q.Categories))))
+	}
+	if q.MinPrice > 0 {
+		where = append(where, "p.price >= "+arg(q.MinPrice))
+	}
+	if q.MaxPrice > 0 {
+		where = append(where, "p.price <= "+arg(q.MaxPrice))
+	}
+	if q.InStock {
+		where = append(where, "p.stock > 0")
+	}
+	if q.SellerID > 0 {
+		where = append(where, "p.seller_id = "+arg(q.SellerID))
+	}
+
+	// The total ignores the cursor so it stays the same on every page
+	filter := " WHERE " + strings.Join(where, " AND ")
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM products p"+filter, args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	order, cmp := " ASC", ">"
+	if sorting.desc {
+		order, cmp = " DESC", "<"
+	}
+	if q.After != nil {
+		where = append(where, fmt.Sprintf("(%s, p.id) %s (%s, %s)",
+			sorting.key, cmp, arg(sorting.value(q.After)), arg(q.After.ID)))
+	}
+	filter = " WHERE " + strings.Join(where, " AND ")
+
+	// One extra row tells whether there is a next page
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id, p.name, COALESCE(p.description, ''), p.price, p.stock, p.category, COALESCE(p.image_url, ''),
+		       p.seller_id, COALESCE(u.name, 'Unknown Seller') AS seller_name, p.created_at, p.units_sold
+		FROM products p
+		LEFT JOIN users u ON p.seller_id = u.id`+filter+`
+		ORDER BY `+sorting.key+order+", p.id"+order+`
+		LIMIT `+arg(q.Limit+1), args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var last store.ProductCursor
+	for rows.Next() {
+		if len(page.Products) == q.Limit {
+			page.Next = &last
+			break
+		}
+		var p models.ProductWithSeller
+		var unitsSold int
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Price, &p.Stock, &p.Category, &p.ImageURL,
+			&p.SellerID, &p.SellerName, &p.CreatedAt, &unitsSold); err != nil {
+			return page, err
+		}
+		page.Products = append(page.Products, p)
+		last = store.ProductCursor{
+			Sort: q.Sort, ID: p.ID, CreatedAt: p.CreatedAt, Price: p.Price, Name: p.Name, UnitsSold: unitsSold,
+		}
+	}
+	return page, rows.Err()
+}
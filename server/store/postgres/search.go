@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// headlineOptions configure ts_headline: matches are wrapped in <mark> and long descriptions are cut down
+// to the fragments around them
+const headlineOptions = `StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "`
+
+// fuzzySnippetLength is how much of the description is shown for near-miss results, which have no matches to highlight
+const fuzzySnippetLength = 160
+
+// escapeHTML returns a SQL expression that HTML-escapes a text expression, so highlighted snippets are safe to render
+func escapeHTML(expr string) string {
+	return fmt.Sprintf(`replace(replace(replace(%s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')`, expr)
+}
+
+// prefixQuery turns search words into a to_tsquery expression requiring every word, each as a prefix,
+// so that "wirel head" finds "wireless headphones"
+func prefixQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = t + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// SearchProducts runs a ranked full-text search over product names, categories and descriptions.
+// When no product contains the words it falls back to trigram similarity on the name to catch misspellings.
+func (s *ProductStore) SearchProducts(ctx context.Context, q store.SearchQuery) (store.SearchPage, error) {
+	var page store.SearchPage
+	terms := store.SearchTerms(q.Text)
+	if len(terms) == 0 {
+		return page, nil
+	}
+
+	// Both queries take the search text as $1 followed by the filter arguments
+	filters, filterArgs := searchFilters(q)
+	args := append([]interface{}{prefixQuery(terms)}, filterArgs...)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM products p WHERE p.search_vector @@ to_tsquery('english', $1)"+filters, args...,
+	).Scan(&page.Total)
+	if err != nil {
+		return page, err
+	}
+	if page.Total > 0 {
+		// Rank only the requested page, then build the (comparatively expensive) headlines for it.
+		// Rank normalization 1 keeps long descriptions from outranking short, exact names.
+		page.Results, err = scanSearchResults(s.db.QueryContext(ctx, `
+			SELECT `+searchResultColumns+`, m.rank,
+			       ts_headline('english', `+escapeHTML("p.name")+`, m.query, 'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'),
+			       ts_headline('english', `+escapeHTML("COALESCE(p.description, '')")+`, m.query, `+arg(headlineOptions)+`)
+			FROM (
+				SELECT p.id, tsq.query, ts_rank(p.search_vector, tsq.query, 1) AS rank
+				FROM products p, to_tsquery('english', $1) AS tsq(query)
+				WHERE p.search_vector @@ tsq.query`+filters+`
+				ORDER BY rank DESC, p.id
+				LIMIT `+arg(q.Limit)+` OFFSET `+arg(q.Offset)+`
+			) m
+			JOIN products p ON p.id = m.id
+			LEFT JOIN users u ON p.seller_id = u.id
+			ORDER BY m.rank DESC, p.id
+		`, args...))
+		return page, err
+	}
+
+	// Nothing matched the words; look for names that are close to the whole query instead.
+	// "<%" is pg_trgm's word similarity operator, answered from idx_products_name_trgm.
+	page.Fuzzy = true
+	args = append([]interface{}{strings.Join(terms, " ")}, filterArgs...)
+	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM products p WHERE $1 <% p.name"+filters, args...).Scan(&page.Total)
+	if err != nil || page.Total == 0 {
+		return page, err
+	}
+	page.Results, err = scanSearchResults(s.db.QueryContext(ctx, `
+		SELECT `+searchResultColumns+`, word_similarity($1, p.name) AS rank,
+		       `+escapeHTML("p.name")+`,
+		       `+escapeHTML(fmt.Sprintf("left(COALESCE(p.description, ''), %d)", fuzzySnippetLength))+`
+		FROM products p
+		LEFT JOIN users u ON p.seller_id = u.id
+		WHERE $1 <% p.name`+filters+`
+		ORDER BY rank DESC, p.id
+		LIMIT `+arg(q.Limit)+` OFFSET `+arg(q.Offset), args...))
+	return page, err
+}
+
+// searchFilters returns the SQL conditions for the search filters, numbered from $2.
+// Unlisted products are always left out.
+func searchFilters(q store.SearchQuery) (string, []interface{}) {
+	conditions := " AND p.unlisted_at IS NULL"
+	var args []interface{}
+	if len(q.Categories) > 0 {
+		args = append(args, pq.Array(q.Categories))
+		conditions += " AND " + categorySubtree(fmt.Sprintf("$%d", len(args)+1))
+	}
+	if q.InStock {
+		conditions += " AND p.stock > 0"
+	}
+	return conditions, args
+}
+
+// searchResultColumns are the product and seller columns of a search result; the rank and highlights follow
+const searchResultColumns = `p.id, p.name, COALESCE(p.description, ''), p.price, p.stock, p.category, COALESCE(p.image_url, ''),
+	p.seller_id, COALESCE(u.name, 'Unknown Seller'), p.created_at`
+
+func scanSearchResults(rows *sql.Rows, err error) ([]models.ProductSearchResult, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.ProductSearchResult
+	for rows.Next() {
+		var r models.ProductSearchResult
+		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &r.Price, &r.Stock, &r.Category, &r.ImageURL,
+			&r.SellerID, &r.SellerName, &r.CreatedAt, &r.Rank, &r.NameHighlight, &r.Snippet); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// likeEscaper escapes the LIKE wildcards in user input
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Suggest completes the search box from product names, categories and sellers in one round trip.
+// Product and seller names containing the text match through the trigram indexes, while the categories table
+// is small enough to scan. Names starting with the text are listed first, and a category counts the products
+// of its subcategories too, like the catalog filter does.
+func (s *ProductStore) Suggest(ctx context.Context, text string, limit int) (models.Suggestions, error) {
+	suggestions := models.Suggestions{
+		Products:   []models.ProductSuggestion{},
+		Categories: []models.CategorySuggestion{},
+		Sellers:    []models.SellerSuggestion{},
+	}
+	escaped := likeEscaper.Replace(text)
+
+	rows, err := s.db.QueryContext(ctx, `
+		(SELECT 'product' AS kind, p.id AS number, p.name AS name, '' AS slug
+		 FROM products p
+		 WHERE p.name ILIKE $1 AND p.unlisted_at IS NULL
+		 ORDER BY p.name ILIKE $2 DESC, word_similarity($3, p.name) DESC, p.name, p.id
+		 LIMIT $4)
+		UNION ALL
+		(WITH RECURSIVE subtree(root, id) AS (
+			SELECT id, id FROM categories WHERE name ILIKE $1
+			UNION ALL
+			SELECT t.root, c.id FROM categories c JOIN subtree t ON c.parent_id = t.id
+		 )
+		 SELECT 'category', COUNT(*), c.name, c.slug
+		 FROM categories c
+		 JOIN subtree t ON t.root = c.id
+		 JOIN products p ON p.category_id = t.id AND p.unlisted_at IS NULL
+		 GROUP BY c.id, c.name, c.slug
+		 ORDER BY c.name ILIKE $2 DESC, COUNT(*) DESC, c.name
+		 LIMIT $4)
+		UNION ALL
+		(SELECT 'seller', u.id, u.name, ''
+		 FROM users u
+		 WHERE u.role = 'seller' AND u.deleted_at IS NULL AND u.name ILIKE $1
+		   AND EXISTS (SELECT 1 FROM products p WHERE p.seller_id = u.id AND p.unlisted_at IS NULL)
+		 ORDER BY u.name ILIKE $2 DESC, u.name, u.id
+		 LIMIT $4)
+	`, "%"+escaped+"%", escaped+"%", text, limit)
+	if err != nil {
+		return suggestions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind, name, slug string
+		var number int
+		if err := rows.Scan(&kind, &number, &name, &slug); err != nil {
+			return suggestions, err
+		}
+		switch kind {
+		case "product":
+			suggestions.Products = append(suggestions.Products, models.ProductSuggestion{ID: number, Name: name})
+		case "category":
+			suggestions.Categories = append(suggestions.Categories, models.CategorySuggestion{Name: name, Slug: slug, ProductCount: number})
+		case "seller":
+			suggestions.Sellers = append(suggestions.Sellers, models.SellerSuggestion{ID: number, Name: name})
+		}
+	}
+	return suggestions, rows.Err()
+}
+
+// RecordSearchMiss counts a search that found nothing against today's row for the query
+func (s *ProductStore) RecordSearchMiss(ctx context.Context, query string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO search_misses (query) VALUES ($1)
+		ON CONFLICT (query, day) DO UPDATE SET searches = search_misses.searches + 1
+	`, query)
+	return err
+}
+
+// ListSearchMisses returns the most searched queries that found nothing since the given day
+func (s *ProductStore) ListSearchMisses(ctx context.Context, since time.Time, limit int) ([]models.SearchMiss, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT query, SUM(searches), MAX(day)
+		FROM search_misses
+		WHERE day >= $1
+		GROUP BY query
+		ORDER BY SUM(searches) DESC, query
+		LIMIT $2
+	`, since.Format(time.DateOnly), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var misses []models.SearchMiss
+	for rows.Next() {
+		var m models.SearchMiss
+		if err := rows.Scan(&m.Query, &m.Searches, &m.LastSearched); err != nil {
+			return nil, err
+		}
+		misses = append(misses, m)
+	}
+	return misses, rows.Err()
+}
@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/rythmokay/golang/server/store"
+)
+
+// SessionStore is the Postgres implementation of store.SessionStore
+type SessionStore struct {
+	db *sql.DB
+}
+
+// CreateRefreshToken stores a refresh token
+func (s *SessionStore) CreateRefreshToken(ctx context.Context, t store.RefreshToken) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, t.UserID, t.FamilyID, t.TokenHash, t.ExpiresAt)
+	return err
+}
+
+// RotateRefreshToken replaces a refresh token with a new one in the same family
+func (s *SessionStore) RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (store.Session, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.Session{}, err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	// Lock the token row so two concurrent refreshes cannot both rotate it
+	var session store.Session
+	var tokenID int
+	var tokenExpiresAt time.Time
+	var revokedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT rt.id, rt.user_id, rt.family_id, rt.expires_at, rt.revoked_at, u.role
+		FROM refresh_tokens rt
+		JOIN users u ON rt.user_id = u.id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt
+	`, oldHash).Scan(&tokenID, &session.UserID, &session.FamilyID, &tokenExpiresAt, &revokedAt, &session.Role)
+	if err != nil {
+		return store.Session{}, notFound(err)
+	}
+
+	// A revoked token being presented again means it was stolen or replayed
+	if revokedAt.Valid {
+		tx.Rollback()
+		if err := s.revokeFamily(ctx, session.FamilyID); err != nil {
+			return session, err
+		}
+		return session, store.ErrTokenReused
+	}
+	if time.Now().After(tokenExpiresAt) {
+		return session, store.ErrTokenExpired
+	}
+
+	var newID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, session.UserID, session.FamilyID, newHash, expiresAt).Scan(&newID)
+	if err != nil {
+		return session, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, replaced_by = $1
+		WHERE id = $2
+	`, newID, tokenID)
+	if err != nil {
+		return session, err
+	}
+	return session, tx.Commit()
+}
+
+// revokeFamily revokes every refresh token that descends from the same login
+func (s *SessionStore) revokeFamily(ctx context.Context, familyID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`, familyID)
+	return err
+}
+
+// RevokeSession revokes the family of one of the user's refresh tokens
+func (s *SessionStore) RevokeSession(ctx context.Context, userID int, tokenHash string) error {
+	var familyID string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT family_id FROM refresh_tokens WHERE token_hash = $1 AND user_id = $2", tokenHash, userID,
+	).Scan(&familyID)
+	if err != nil {
+		return notFound(err)
+	}
+	return s.revokeFamily(ctx, familyID)
+}
+
+// RevokeUserSessions revokes every token family of the user but one
+func (s *SessionStore) RevokeUserSessions(ctx context.Context, userID int, keepFamilyID string) error {
+	return revokeUserSessions(ctx, s.db, userID, keepFamilyID)
+}
+
+// SessionActive reports whether the family still has a token that has not been revoked
+func (s *SessionStore) SessionActive(ctx context.Context, userID int, familyID string) (bool, error) {
+	var active bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM refresh_tokens WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL)",
+		userID, familyID,
+	).Scan(&active)
+	return active, err
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// revokeUserSessions revokes a user's refresh tokens, except those in keepFamilyID, on db or inside a transaction
+func revokeUserSessions(ctx context.Context, db execer, userID int, keepFamilyID string) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL
+	`, userID, keepFamilyID)
+	return err
+}
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/rythmokay/golang/server/store"
+)
+
+// ThrottleStore is the Postgres implementation of store.ThrottleStore
+type ThrottleStore struct {
+	db *sql.DB
+}
+
+// LockedUntil returns the latest lockout still in force for any of the keys
+func (s *ThrottleStore) LockedUntil(ctx context.Context, keys ...store.ThrottleKey) (time.Time, error) {
+	var latest time.Time
+	for _, k := range keys {
+		var lockedUntil sql.NullTime
+		err := s.db.QueryRowContext(ctx, `
+			SELECT locked_until FROM login_throttles
+			WHERE scope = $1 AND key = $2 AND locked_until > CURRENT_TIMESTAMP
+		`, k.Scope, k.Key).Scan(&lockedUntil)
+		if err != nil && err != sql.ErrNoRows {
+			return time.Time{}, err
+		}
+		if lockedUntil.Valid && lockedUntil.Time.After(latest) {
+			latest = lockedUntil.Time
+		}
+	}
+	return latest, nil
+}
+
+// RecordFailure counts a failed login; failures older than window no longer count towards a lockout
+func (s *ThrottleStore) RecordFailure(ctx context.Context, key store.ThrottleKey, window time.Duration) (int, error) {
+	var failures int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO login_throttles (scope, key, failures, last_failure_at)
+		VALUES ($1, $2, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (scope, key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttles.last_failure_at < CURRENT_TIMESTAMP - make_interval(secs => $3) THEN 1
+				ELSE login_throttles.failures + 1
+			END,
+			last_failure_at = CURRENT_TIMESTAMP
+		RETURNING failures
+	`, key.Scope, key.Key, window.Seconds()).Scan(&failures)
+	return failures, err
+}
+
+// Lock refuses logins for the key until the given time
+func (s *ThrottleStore) Lock(ctx context.Context, key store.ThrottleKey, until time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE login_throttles SET locked_until = $1 WHERE scope = $2 AND key = $3", until, key.Scope, key.Key)
+	return err
+}
+
+// Clear forgets the failures counted against the key
+func (s *ThrottleStore) Clear(ctx context.Context, key store.ThrottleKey) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_throttles WHERE scope = $1 AND key = $2", key.Scope, key.Key)
+	return err
+}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rythmokay/golang/server/store"
+)
+
+// TwoFactorStore is the Postgres implementation of store.TwoFactorStore
+type TwoFactorStore struct {
+	db *sql.DB
+}
+
+// SetTOTPSecret stores a secret for an unconfirmed enrollment
+func (s *TwoFactorStore) SetTOTPSecret(ctx context.Context, userID int, secret string) error {
+	return requireRow(s.db.ExecContext(ctx,
+		"UPDATE users SET totp_secret = $1, totp_last_step = NULL WHERE id = $2", secret, userID))
+}
+
+// GetTOTPSecret returns the user's secret, or "" before enrollment starts
+func (s *TwoFactorStore) GetTOTPSecret(ctx context.Context, userID int) (string, error) {
+	var secret sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT totp_secret FROM users WHERE id = $1", userID).Scan(&secret)
+	return secret.String, notFound(err)
+}
+
+// EnableTwoFactor confirms the enrollment and replaces the recovery codes, all or nothing
+func (s *TwoFactorStore) EnableTwoFactor(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	err = requireRow(tx.ExecContext(ctx, "UPDATE users SET totp_enabled = TRUE, totp_last_step = $1 WHERE id = $2", step, userID))
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM totp_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateChallenge stores a login challenge
+func (s *TwoFactorStore) CreateChallenge(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO two_factor_challenges (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, tokenHash, expiresAt)
+	return err
+}
+
+// GetChallenge looks up a challenge that can still be completed, with its user
+func (s *TwoFactorStore) GetChallenge(ctx context.Context, tokenHash string, maxAttempts int) (store.TwoFactorChallenge, error) {
+	var c store.TwoFactorChallenge
+	var secret sql.NullString
+	var lastStep sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT c.id, u.id, u.name, u.email, u.role, u.email_verified, u.totp_enabled, u.totp_secret, u.totp_last_step
+		FROM two_factor_challenges c
+		JOIN users u ON c.user_id = u.id
+		WHERE c.token_hash = $1 AND c.used_at IS NULL
+			AND c.expires_at > CURRENT_TIMESTAMP AND c.attempts < $2
+	`, tokenHash, maxAttempts).Scan(
+		&c.ID, &c.User.ID, &c.User.Name, &c.User.Email, &c.User.Role, &c.User.EmailVerified, &c.User.TwoFactorEnabled,
+		&secret, &lastStep,
+	)
+	c.Secret = secret.String
+	if lastStep.Valid {
+		c.LastStep = &lastStep.Int64
+	}
+	return c, notFound(err)
+}
+
+// CompleteChallengeWithCode uses up the challenge and records the code's time step so it cannot be replayed
+func (s *TwoFactorStore) CompleteChallengeWithCode(ctx context.Context, challengeID, userID int, step int64) error {
+	return s.completeChallenge(ctx, challengeID, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.ExecContext(ctx, `
+			UPDATE users SET totp_last_step = $1
+			WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)
+		`, step, userID)
+	})
+}
+
+// CompleteChallengeWithRecoveryCode uses up the challenge and the recovery code
+func (s *TwoFactorStore) CompleteChallengeWithRecoveryCode(ctx context.Context, challengeID, userID int, codeHash string) error {
+	return s.completeChallenge(ctx, challengeID, func(tx *sql.Tx) (sql.Result, error) {
+		return tx.ExecContext(ctx, `
+			UPDATE totp_recovery_codes
+			SET used_at = CURRENT_TIMESTAMP
+			WHERE id = (
+				SELECT id FROM totp_recovery_codes
+				WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+				LIMIT 1
+				FOR UPDATE
+			)
+		`, userID, codeHash)
+	})
+}
+
+// completeChallenge marks the challenge used and applies useCode, which must change exactly one row for the
+// code to count. Both happen in one transaction so neither the challenge nor the code can be used twice.
+func (s *TwoFactorStore) completeChallenge(ctx context.Context, challengeID int, useCode func(tx *sql.Tx) (sql.Result, error)) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	err = requireRow(tx.ExecContext(ctx,
+		"UPDATE two_factor_challenges SET used_at = CURRENT_TIMESTAMP WHERE id = $1 AND used_at IS NULL", challengeID))
+	if err != nil {
+		return err
+	}
+	err = requireRow(useCode(tx))
+	if errors.Is(err, store.ErrNotFound) {
+		return store.ErrInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// FailChallenge counts a wrong code against the challenge
+func (s *TwoFactorStore) FailChallenge(ctx context.Context, challengeID int) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE two_factor_challenges SET attempts = attempts + 1 WHERE id = $1", challengeID)
+	return err
+}
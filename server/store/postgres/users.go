@@ -0,0 +1,281 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/rythmokay/golang/server/database"
+	"github.com/rythmokay/golang/server/models"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// UserStore is the Postgres implementation of store.UserStore
+type UserStore struct {
+	db *sql.DB
+}
+
+const userColumns = `id, name, email, password, role, COALESCE(address, ''), COALESCE(phone_number, ''), email_verified, totp_enabled`
+
+func scanUser(row scanner) (models.User, error) {
+	var u models.User
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Password, &u.Role, &u.Address, &u.PhoneNumber, &u.EmailVerified, &u.TwoFactorEnabled)
+	return u, notFound(err)
+}
+
+// CreateUser inserts a new user
+func (s *UserStore) CreateUser(ctx context.Context, u *models.User) error {
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO users (name, email, password, role) VALUES ($1, $2, $3, $4) RETURNING id",
+		u.Name, u.Email, u.Password, u.Role,
+	).Scan(&u.ID)
+	if database.IsUniqueViolation(err) {
+		return fmt.Errorf("%w: %w", store.ErrEmailTaken, err)
+	}
+	return constraintError(err)
+}
+
+// GetUserByID looks up a user by id
+func (s *UserStore) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id))
+}
+
+// GetUserByEmail looks up a user by email address
+func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	return scanUser(s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1", email))
+}
+
+// AccountActive reports whether the user exists and has not been deleted
+func (s *UserStore) AccountActive(ctx context.Context, id int) (bool, error) {
+	var active bool
+	err := s.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)", id,
+	).Scan(&active)
+	return active, err
+}
+
+// SetRole changes the role of an active user
+func (s *UserStore) SetRole(ctx context.Context, id int, role string) error {
+	return requireRow(s.db.ExecContext(ctx,
+		"UPDATE users SET role = $1 WHERE id = $2 AND deleted_at IS NULL", role, id,
+	))
+}
+
+// UpdateProfile changes the editable profile fields
+func (s *UserStore) UpdateProfile(ctx context.Context, id int, name, address, phoneNumber string) error {
+	return requireRow(s.db.ExecContext(ctx,
+		"UPDATE users SET name = $1, address = $2, phone_number = $3 WHERE id = $4",
+		name, address, phoneNumber, id,
+	))
+}
+
+// GetSellerProfile looks up a seller with the number of products they list
+func (s *UserStore) GetSellerProfile(ctx context.Context, id int) (models.SellerProfile, error) {
+	var p models.SellerProfile
+	var memberSince sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT u.id, u.name, u.created_at, COUNT(p.id)
+		FROM users u
+		LEFT JOIN products p ON p.seller_id = u.id AND p.unlisted_at IS NULL
+		WHERE u.id = $1 AND u.role = 'seller'
+		GROUP BY u.id
+	`, id).Scan(&p.ID, &p.Name, &memberSince, &p.ProductCount)
+	if memberSince.Valid {
+		p.MemberSince = &memberSince.Time
+	}
+	return p, notFound(err)
+}
+
+// SetPassword replaces the password hash and revokes the user's other sessions, all or nothing
+func (s *UserStore) SetPassword(ctx context.Context, id int, passwordHash, keepFamilyID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	if err := requireRow(tx.ExecContext(ctx, "UPDATE users SET password = $1 WHERE id = $2", passwordHash, id)); err != nil {
+		return err
+	}
+	if err := revokeUserSessions(ctx, tx, id, keepFamilyID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ExportUserData gathers the user's profile, addresses, cart and orders, and the products of a seller
+func (s *UserStore) ExportUserData(ctx context.Context, id int) (models.UserDataExport, error) {
+	export := models.UserDataExport{
+		ExportedAt: time.Now(),
+		Addresses:  []string{},
+		Cart:       []models.CartItemWithProduct{},
+		Orders:     []models.OrderWithItemDetails{},
+	}
+
+	p := &export.Profile
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, name, email, role, COALESCE(address, ''), COALESCE(phone_number, ''), email_verified, totp_enabled, created_at
+		FROM users
+		WHERE id = $1
+	`, id).Scan(&p.ID, &p.Name, &p.Email, &p.Role, &p.Address, &p.PhoneNumber, &p.EmailVerified, &p.TwoFactorEnabled, &export.CreatedAt)
+	if err != nil {
+		return export, notFound(err)
+	}
+
+	// Addresses are the profile address plus every address an order was shipped to
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT address FROM users WHERE id = $1 AND COALESCE(address, '') <> ''
+		UNION
+		SELECT shipping_address FROM orders WHERE user_id = $1
+	`, id)
+	if err != nil {
+		return export, err
+	}
+	for rows.Next() {
+		var address string
+		if err := rows.Scan(&address); err != nil {
+			rows.Close()
+			return export, err
+		}
+		export.Addresses = append(export.Addresses, address)
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT c.id, c.quantity, p.id, p.name, p.price, COALESCE(p.image_url, '')
+		FROM cart_items c
+		JOIN products p ON c.product_id = p.id
+		WHERE c.user_id = $1
+	`, id)
+	if err != nil {
+		return export, err
+	}
+	for rows.Next() {
+		var item models.CartItemWithProduct
+		if err := rows.Scan(&item.ID, &item.Quantity, &item.Product.ID, &item.Product.Name, &item.Product.Price, &item.Product.ImageURL); err != nil {
+			rows.Close()
+			return export, err
+		}
+		export.Cart = append(export.Cart, item)
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT id, user_id, total_amount, status, payment_method, COALESCE(payment_id, ''), shipping_address, contact_number, created_at, updated_at
+		FROM orders
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, id)
+	if err != nil {
+		return export, err
+	}
+	for rows.Next() {
+		var o models.OrderWithItemDetails
+		err := rows.Scan(&o.Order.ID, &o.Order.UserID, &o.Order.TotalAmount, &o.Order.Status, &o.Order.PaymentMethod,
+			&o.Order.PaymentID, &o.Order.ShippingAddress, &o.Order.ContactNumber, &o.Order.CreatedAt, &o.Order.UpdatedAt)
+		if err != nil {
+			rows.Close()
+			return export, err
+		}
+		o.UserName = export.Profile.Name
+		export.Orders = append(export.Orders, o)
+	}
+	rows.Close()
+
+	for i := range export.Orders {
+		order := &export.Orders[i]
+		itemRows, err := s.db.QueryContext(ctx, `
+			SELECT oi.id, oi.order_id, oi.product_id, p.seller_id, oi.quantity, oi.price, oi.created_at,
+				   p.name, COALESCE(p.image_url, '')
+			FROM order_items oi
+			JOIN products p ON oi.product_id = p.id
+			WHERE oi.order_id = $1
+		`, order.Order.ID)
+		if err != nil {
+			return export, err
+		}
+		for itemRows.Next() {
+			var item models.OrderItemWithDetails
+			err := itemRows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.SellerID, &item.Quantity,
+				&item.Price, &item.CreatedAt, &item.ProductName, &item.ProductImage)
+			if err != nil {
+				itemRows.Close()
+				return export, err
+			}
+			order.OrderItems = append(order.OrderItems, item)
+		}
+		itemRows.Close()
+	}
+
+	if export.Profile.Role == models.RoleSeller {
+		rows, err = s.db.QueryContext(ctx,
+			"SELECT "+productColumns+" FROM products WHERE seller_id = $1 ORDER BY created_at DESC", id)
+		if err != nil {
+			return export, err
+		}
+		for rows.Next() {
+			p, err := scanProduct(rows)
+			if err != nil {
+				rows.Close()
+				return export, err
+			}
+			export.Products = append(export.Products, p)
+		}
+		rows.Close()
+	}
+
+	return export, nil
+}
+
+// DeleteAccount anonymizes a user. Users are kept rather than removed because orders and products reference
+// them and sellers still need the records of orders they have to fulfil.
+func (s *UserStore) DeleteAccount(ctx context.Context, id int, passwordHash string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	var oldEmail string
+	err = tx.QueryRowContext(ctx, "SELECT email FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&oldEmail)
+	if err != nil {
+		return notFound(err)
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		// Personal data on the user row
+		{`UPDATE users
+			SET name = 'Deleted user', email = $1, password = $2, address = NULL, phone_number = NULL,
+				email_verified = FALSE, totp_secret = NULL, totp_enabled = FALSE, totp_last_step = NULL,
+				deleted_at = CURRENT_TIMESTAMP
+			WHERE id = $3`,
+			[]interface{}{fmt.Sprintf("deleted-user-%d@deleted.invalid", id), passwordHash, id}},
+		// Sessions, credentials and carts have no value once the account is gone
+		{"DELETE FROM cart_items WHERE user_id = $1", []interface{}{id}},
+		{"DELETE FROM refresh_tokens WHERE user_id = $1", []interface{}{id}},
+		{"DELETE FROM password_reset_tokens WHERE user_id = $1", []interface{}{id}},
+		{"DELETE FROM email_verification_tokens WHERE user_id = $1", []interface{}{id}},
+		{"DELETE FROM totp_recovery_codes WHERE user_id = $1", []interface{}{id}},
+		{"DELETE FROM two_factor_challenges WHERE user_id = $1", []interface{}{id}},
+		{"DELETE FROM login_throttles WHERE scope = $1 AND key = lower(trim($2))", []interface{}{store.ThrottleScopeAccount, oldEmail}},
+		{"UPDATE auth_audit_log SET email = NULL WHERE email = $1", []interface{}{oldEmail}},
+		// Finished orders no longer need contact details; open ones keep them so sellers can deliver
+		{`UPDATE orders
+			SET shipping_address = '[redacted]', contact_number = '[redacted]'
+			WHERE user_id = $1 AND status IN ('delivered', 'cancelled')`,
+			[]interface{}{id}},
+		// A deleted seller's listings stay for order history but leave the storefront and can no longer be bought
+		{"UPDATE products SET stock = 0, unlisted_at = CURRENT_TIMESTAMP WHERE seller_id = $1 AND unlisted_at IS NULL", []interface{}{id}},
+		{"DELETE FROM cart_items WHERE product_id IN (SELECT id FROM products WHERE seller_id = $1)", []interface{}{id}},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/rythmokay/golang/server/database"
+	"github.com/rythmokay/golang/server/store"
+)
+
+// VerificationStore is the Postgres implementation of store.VerificationStore
+type VerificationStore struct {
+	db *sql.DB
+}
+
+// CreateEmailVerification stores a verification token for the given address
+func (s *VerificationStore) CreateEmailVerification(ctx context.Context, userID int, email, tokenHash string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, email, tokenHash, expiresAt)
+	return err
+}
+
+// RetireEmailVerifications uses up the user's outstanding tokens
+func (s *VerificationStore) RetireEmailVerifications(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE email_verification_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND used_at IS NULL
+	`, userID)
+	return err
+}
+
+// VerifyEmail uses up a token and makes its address the user's verified email
+func (s *VerificationStore) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	var tokenID, userID int
+	var email sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id, email
+		FROM email_verification_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		FOR UPDATE
+	`, tokenHash).Scan(&tokenID, &userID, &email)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	// Tokens issued for an email change also switch the account to the new address
+	_, err = tx.ExecContext(ctx,
+		"UPDATE users SET email = COALESCE($1, email), email_verified = TRUE WHERE id = $2",
+		email, userID,
+	)
+	if database.IsUniqueViolation(err) {
+		return userID, fmt.Errorf("%w: %w", store.ErrEmailTaken, err)
+	}
+	if err != nil {
+		return userID, err
+	}
+
+	// Retire this token and any others outstanding for the same address
+	_, err = tx.ExecContext(ctx, `
+		UPDATE email_verification_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND used_at IS NULL AND (id = $2 OR email = $3)
+	`, userID, tokenID, email)
+	if err != nil {
+		return userID, err
+	}
+	return userID, tx.Commit()
+}
+
+// PendingEmailVerification returns the address of the user's latest outstanding token
+func (s *VerificationStore) PendingEmailVerification(ctx context.Context, userID int) (string, error) {
+	var email string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT email FROM email_verification_tokens
+		WHERE user_id = $1 AND email IS NOT NULL AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, userID).Scan(&email)
+	return email, notFound(err)
+}
+
+// ListEmailVerificationTimes returns when tokens were issued to the user since the given time
+func (s *VerificationStore) ListEmailVerificationTimes(ctx context.Context, userID int, since time.Time) ([]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT created_at FROM email_verification_tokens
+		WHERE user_id = $1 AND created_at > $2
+		ORDER BY created_at
+	`, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, rows.Err()
+}
@@ -0,0 +1,245 @@
+// Package store defines the repositories the HTTP handlers use to read and write shop data.
+// The postgres subpackage is the production implementation; the memory subpackage keeps
+// everything in process so handlers can be exercised without a database.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rythmokay/golang/server/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	// (or does not belong to the user it was requested for)
+	ErrNotFound = errors.New("not found")
+	// ErrEmailTaken is returned when another user already has the email address
+	ErrEmailTaken = errors.New("email already registered")
+	// ErrInvalid is returned when a write is rejected by a data constraint
+	ErrInvalid = errors.New("invalid value")
+	// ErrEmptyCart is returned when checking out a cart with no items
+	ErrEmptyCart = errors.New("cart is empty")
+	// ErrCategoryExists is returned when another category has the slug, or a sibling has the name
+	ErrCategoryExists = errors.New("category already exists")
+	// ErrCategoryCycle is returned when a category would be moved under itself or one of its subcategories
+	ErrCategoryCycle = errors.New("category cannot be its own ancestor")
+	// ErrCategoryInUse is returned when deleting a category that still has subcategories or products
+	ErrCategoryInUse = errors.New("category is in use")
+	// ErrProductInUse is returned when deleting a product that is still in a cart or an order
+	ErrProductInUse = errors.New("product is in use")
+)
+
+// InsufficientStockError is returned by checkout when a cart item asks for more than is in stock
+type InsufficientStockError struct {
+	ProductID int
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("product ID %d does not have enough stock", e.ProductID)
+}
+
+// Stores groups the repositories a server needs
+type Stores struct {
+	Users      UserStore
+	Products   ProductStore
+	Categories CategoryStore
+	Carts      CartStore
+	Orders     OrderStore
+
+	// Sessions, PasswordResets, Verifications and TwoFactor hold the credentials issued to users;
+	// Throttles and Audit back the login lockout and the security audit log
+	Sessions       SessionStore
+	PasswordResets PasswordResetStore
+	Verifications  VerificationStore
+	TwoFactor      TwoFactorStore
+	Throttles      ThrottleStore
+	Audit          AuditStore
+}
+
+// UserStore reads and writes user accounts
+type UserStore interface {
+	// CreateUser inserts u, whose Password must already be hashed, and sets u.ID
+	CreateUser(ctx context.Context, u *models.User) error
+	// GetUserByID returns the user including the password hash
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	// GetUserByEmail returns the user including the password hash
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	// AccountActive reports whether a user exists and has not deleted their account
+	AccountActive(ctx context.Context, id int) (bool, error)
+	// UpdateProfile changes the name, address and phone number of a user
+	UpdateProfile(ctx context.Context, id int, name, address, phoneNumber string) error
+	// GetSellerProfile returns the public profile of a seller and returns ErrNotFound for other users
+	GetSellerProfile(ctx context.Context, id int) (models.SellerProfile, error)
+	// SetRole changes the role of a user and returns ErrNotFound if the account does not exist or is deleted
+	SetRole(ctx context.Context, id int, role string) error
+	// SetPassword replaces a user's password hash and revokes every session except keepFamilyID
+	SetPassword(ctx context.Context, id int, passwordHash, keepFamilyID string) error
+	// ExportUserData gathers everything stored about a user for a personal data export
+	ExportUserData(ctx context.Context, id int) (models.UserDataExport, error)
+	// DeleteAccount anonymizes a user, replacing the password with passwordHash, removes their sessions,
+	// credentials, cart and throttles and unlists their products, all or nothing. It returns ErrNotFound if
+	// the account is already deleted.
+	DeleteAccount(ctx context.Context, id int, passwordHash string) error
+}
+
+// ProductStore reads and writes the catalog.
+// Products of deleted sellers are unlisted: they are kept for order history, but the storefront lookups
+// below skip them and GetProduct returns ErrNotFound for them.
+type ProductStore interface {
+	// CreateProduct inserts p and sets p.ID
+	CreateProduct(ctx context.Context, p *models.Product) error
+	GetProduct(ctx context.Context, id int) (models.Product, error)
+	// UpdateProduct saves p if it belongs to p.SellerID and returns ErrNotFound otherwise
+	UpdateProduct(ctx context.Context, p *models.Product) error
+	// DeleteProduct removes a product if it belongs to sellerID and returns ErrNotFound otherwise,
+	// or ErrProductInUse while a cart or an order refers to it
+	DeleteProduct(ctx context.Context, id, sellerID int) error
+	// ListRelatedProducts returns up to limit other products to show with p: those most often ordered
+	// together with it, then bestsellers from its category
+	ListRelatedProducts(ctx context.Context, p models.Product, limit int) ([]models.ProductWithSeller, error)
+	// ListSellerProducts returns a seller's products, newest first
+	ListSellerProducts(ctx context.Context, sellerID int) ([]models.Product, error)
+	// ListProducts returns one page of the storefront catalog matching q
+	ListProducts(ctx context.Context, q ProductQuery) (ProductPage, error)
+	// SearchProducts returns one page of products matching the search words, falling back to products
+	// with similar names when nothing matches exactly
+	SearchProducts(ctx context.Context, q SearchQuery) (SearchPage, error)
+	// Suggest returns up to limit products, categories and sellers whose names contain the typed text,
+	// those starting with it first
+	Suggest(ctx context.Context, text string, limit int) (models.Suggestions, error)
+	// RecordSearchMiss counts a search for query that found nothing
+	RecordSearchMiss(ctx context.Context, query string) error
+	// ListSearchMisses returns the queries that found nothing since the given day, most searched first
+	ListSearchMisses(ctx context.Context, since time.Time, limit int) ([]models.SearchMiss, error)
+}
+
+// CategoryStore reads and writes the category tree
+type CategoryStore interface {
+	// ListCategories returns every category ordered by position and name, each counting the products
+	// filed directly under it; models.CategoryTree nests them
+	ListCategories(ctx context.Context) ([]models.Category, error)
+	GetCategory(ctx context.Context, id int) (models.Category, error)
+	GetCategoryBySlug(ctx context.Context, slug string) (models.Category, error)
+	// CreateCategory inserts c and sets c.ID. It returns ErrCategoryExists when the slug or the name
+	// among its siblings is taken.
+	CreateCategory(ctx context.Context, c *models.Category) error
+	// UpdateCategory renames, moves or reorders a category, and renames it on the products filed under it.
+	// It returns ErrCategoryCycle when the new parent is the category itself or one of its subcategories.
+	UpdateCategory(ctx context.Context, c *models.Category) error
+	// DeleteCategory removes a category, or returns ErrCategoryInUse while it has subcategories or products
+	DeleteCategory(ctx context.Context, id int) error
+}
+
+// CartStore reads and writes shopping carts
+type CartStore interface {
+	// AddCartItem adds quantity of a product to the user's cart, increasing it if already present
+	AddCartItem(ctx context.Context, userID, productID, quantity int) error
+	GetCartItem(ctx context.Context, id int) (models.CartItem, error)
+	ListCartItems(ctx context.Context, userID int) ([]models.CartItemWithProduct, error)
+	// UpdateCartItemQuantity sets the quantity of one of the user's cart items
+	UpdateCartItemQuantity(ctx context.Context, id, userID, quantity int) error
+	// DeleteCartItem removes one of the user's cart items
+	DeleteCartItem(ctx context.Context, id, userID int) error
+}
+
+// OrderStore reads and writes orders
+type OrderStore interface {
+	// Checkout turns the user's cart into an order with the given status, takes the items out of stock
+	// and empties the cart, all or nothing. It returns ErrEmptyCart or an *InsufficientStockError when
+	// the cart cannot be ordered.
+	Checkout(ctx context.Context, userID int, req models.CheckoutRequest, status string) (int, error)
+	GetOrder(ctx context.Context, id int) (models.ExtendedOrder, error)
+	// ListUserOrders returns the orders a user has placed, newest first
+	ListUserOrders(ctx context.Context, userID int) ([]models.ExtendedOrder, error)
+	// ListSellerOrders returns the orders containing a seller's products, newest first
+	ListSellerOrders(ctx context.Context, sellerID int) ([]models.SellerOrder, error)
+	// ListOrderItems returns the items of an order; a non-zero sellerID keeps only that seller's items
+	ListOrderItems(ctx context.Context, orderID, sellerID int) ([]models.OrderItemWithDetails, error)
+	// SellerHasItems reports whether the order exists and whether it contains products sold by sellerID
+	SellerHasItems(ctx context.Context, orderID, sellerID int) (orderExists, hasItems bool, err error)
+	UpdateOrderStatus(ctx context.Context, orderID int, status string) error
+}
+
+// SessionStore reads and writes refresh tokens. Tokens issued from one login form a family that is revoked together.
+type SessionStore interface {
+	// CreateRefreshToken stores a refresh token, starting a family or continuing one
+	CreateRefreshToken(ctx context.Context, t RefreshToken) error
+	// RotateRefreshToken retires the token with oldHash and stores newHash in its family in its place.
+	// It returns ErrNotFound for unknown tokens, ErrTokenExpired for expired ones, and ErrTokenReused,
+	// after revoking the family, for tokens that were already rotated.
+	RotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (Session, error)
+	// RevokeSession revokes the family of one of the user's refresh tokens, or returns ErrNotFound
+	RevokeSession(ctx context.Context, userID int, tokenHash string) error
+	// RevokeUserSessions revokes every token family of the user except keepFamilyID, which may be empty
+	RevokeUserSessions(ctx context.Context, userID int, keepFamilyID string) error
+	// SessionActive reports whether the user's token family exists and has not been revoked
+	SessionActive(ctx context.Context, userID int, familyID string) (bool, error)
+}
+
+// PasswordResetStore reads and writes single-use password reset tokens
+type PasswordResetStore interface {
+	// CreatePasswordReset stores a reset token, retiring the user's earlier ones so only the latest link works
+	CreatePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	// ResetPassword uses up an unexpired token, sets the password hash and revokes all of the user's sessions.
+	// It returns the user's id, or ErrNotFound when the token is unknown, used or expired.
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error)
+}
+
+// VerificationStore reads and writes email verification tokens. Each token names the address it verifies,
+// which becomes the user's email when it is used.
+type VerificationStore interface {
+	CreateEmailVerification(ctx context.Context, userID int, email, tokenHash string, expiresAt time.Time) error
+	// RetireEmailVerifications uses up the user's outstanding tokens
+	RetireEmailVerifications(ctx context.Context, userID int) error
+	// VerifyEmail uses up an unexpired token and marks its address as the user's verified email. It returns
+	// the user's id, ErrNotFound when the token is unknown, used or expired, or ErrEmailTaken.
+	VerifyEmail(ctx context.Context, tokenHash string) (int, error)
+	// PendingEmailVerification returns the address of the user's latest outstanding token, or ErrNotFound
+	PendingEmailVerification(ctx context.Context, userID int) (string, error)
+	// ListEmailVerificationTimes returns when tokens were issued to the user since the given time, oldest first
+	ListEmailVerificationTimes(ctx context.Context, userID int, since time.Time) ([]time.Time, error)
+}
+
+// TwoFactorStore reads and writes TOTP secrets, recovery codes and login challenges
+type TwoFactorStore interface {
+	// SetTOTPSecret stores a secret for an enrollment that is not confirmed yet
+	SetTOTPSecret(ctx context.Context, userID int, secret string) error
+	// GetTOTPSecret returns the user's secret, or "" before enrollment starts
+	GetTOTPSecret(ctx context.Context, userID int) (string, error)
+	// EnableTwoFactor confirms the enrollment at the given time step and replaces the recovery codes
+	EnableTwoFactor(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error
+	CreateChallenge(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	// GetChallenge returns an unused, unexpired challenge with fewer than maxAttempts failures, or ErrNotFound
+	GetChallenge(ctx context.Context, tokenHash string, maxAttempts int) (TwoFactorChallenge, error)
+	// CompleteChallengeWithCode uses up the challenge with a TOTP code from the given time step. It returns
+	// ErrInvalidCode unless the step is newer than the last one used, and ErrNotFound if the challenge was
+	// completed meanwhile.
+	CompleteChallengeWithCode(ctx context.Context, challengeID, userID int, step int64) error
+	// CompleteChallengeWithRecoveryCode uses up the challenge and one of the user's recovery codes.
+	// It returns ErrInvalidCode if no unused code has the hash, and ErrNotFound if the challenge was
+	// completed meanwhile.
+	CompleteChallengeWithRecoveryCode(ctx context.Context, challengeID, userID int, codeHash string) error
+	// FailChallenge counts a wrong code against the challenge
+	FailChallenge(ctx context.Context, challengeID int) error
+}
+
+// ThrottleStore counts failed logins per account and per client IP
+type ThrottleStore interface {
+	// LockedUntil returns the latest lockout still in force for any of the keys, or the zero time
+	LockedUntil(ctx context.Context, keys ...ThrottleKey) (time.Time, error)
+	// RecordFailure counts a failed login and returns the consecutive failures, starting again from one
+	// when the previous failure is older than window
+	RecordFailure(ctx context.Context, key ThrottleKey, window time.Duration) (int, error)
+	// Lock refuses logins for the key until the given time
+	Lock(ctx context.Context, key ThrottleKey, until time.Time) error
+	// Clear forgets the failures counted against the key
+	Clear(ctx context.Context, key ThrottleKey) error
+}
+
+// AuditStore writes the security audit log
+type AuditStore interface {
+	RecordEvent(ctx context.Context, e AuthEvent) error
+}
@@ -1,43 +1,229 @@
 package utils
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/rythmokay/golang/server/apierror"
+	"github.com/rythmokay/golang/server/config"
+	"github.com/rythmokay/golang/server/logging"
 )
 
-// AuthMiddleware is a middleware that checks for authentication
-func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Handle preflight OPTIONS requests
-		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+// Principal is the authenticated user attached to a request
+type Principal struct {
+	UserID int
+	Role   string
+	// SessionID identifies the login (refresh token family) the access token was issued for
+	SessionID string
+}
+
+// Claims are the claims carried by an access token
+type Claims struct {
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type contextKey string
 
-		// Set CORS headers for all responses
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+const principalKey contextKey = "principal"
 
+// AccountChecker reports whether a user may still use the API.
+// store.UserStore implements it.
+type AccountChecker interface {
+	AccountActive(ctx context.Context, id int) (bool, error)
+}
+
+// SessionChecker reports whether the login an access token was issued for has been revoked.
+// store.SessionStore implements it.
+type SessionChecker interface {
+	SessionActive(ctx context.Context, userID int, familyID string) (bool, error)
+}
+
+// Authenticator issues and verifies access tokens
+type Authenticator struct {
+	secret   []byte
+	issuer   string
+	ttl      time.Duration
+	accounts AccountChecker
+	sessions SessionChecker
+}
+
+// NewAuthenticator returns an Authenticator using the token settings in cfg.
+// Middleware asks accounts and sessions on every request so tokens of deleted accounts
+// and revoked logins stop working before they expire.
+func NewAuthenticator(cfg config.AuthConfig, accounts AccountChecker, sessions SessionChecker) *Authenticator {
+	return &Authenticator{
+		secret:   []byte(cfg.JWTSecret),
+		issuer:   cfg.JWTIssuer,
+		ttl:      cfg.AccessTokenTTL,
+		accounts: accounts,
+		sessions: sessions,
+	}
+}
+
+// GenerateToken issues a signed access token for the given user and session
+func (a *Authenticator) GenerateToken(userID int, role, sessionID string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(a.ttl)
+
+	claims := Claims{
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			Issuer:    a.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(a.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseToken verifies the signature and expiry of an access token and returns its principal
+func (a *Authenticator) ParseToken(tokenString string) (Principal, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return a.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(a.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || userID <= 0 {
+		return Principal{}, errors.New("invalid token subject")
+	}
+	return Principal{UserID: userID, Role: claims.Role, SessionID: claims.SessionID}, nil
+}
+
+// GenerateOpaqueToken returns a random URL-safe token and the SHA-256 hash to store for it
+func GenerateOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 hash of an opaque token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated principal
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFromContext returns the authenticated principal stored in ctx, if any
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey).(Principal)
+	return p, ok
+}
+
+// Middleware rejects requests without a valid access token and attaches the principal to the rest.
+// CORS, including preflight requests, is handled by the cors middleware in front of the mux.
+func (a *Authenticator) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		// Get the Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+			apierror.Write(w, r, apierror.Unauthorized("Authorization header is required"))
 			return
 		}
 
 		// Check if it's a Bearer token
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
+			apierror.Write(w, r, apierror.Unauthorized("Invalid authorization format"))
+			return
+		}
+
+		// Verify the token and attach the principal to the request
+		principal, err := a.ParseToken(parts[1])
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			apierror.Write(w, r, apierror.Unauthorized("Invalid or expired token"))
+			return
+		}
+
+		// A signature only proves the account existed when the token was issued
+		active, err := a.accounts.AccountActive(r.Context(), principal.UserID)
+		if err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+		if !active {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			apierror.Write(w, r, apierror.Unauthorized("Account no longer exists"))
+			return
+		}
+
+		// Logging out, password changes and refresh token reuse revoke the login the token belongs to
+		active, err = a.sessions.SessionActive(r.Context(), principal.UserID, principal.SessionID)
+		if err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+		if !active {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			apierror.Write(w, r, apierror.Unauthorized("Session has been revoked"))
+			return
+		}
+
+		logging.SetUserID(r.Context(), principal.UserID)
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	}
+}
+
+// RequireRole is a middleware that only lets through principals with the given role.
+// It must be wrapped by Authenticator.Middleware so that a principal is present on the request.
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			apierror.Write(w, r, apierror.Unauthorized("Authentication required"))
+			return
+		}
+
+		if principal.Role != role {
+			apierror.Write(w, r, apierror.Forbidden("You do not have permission to access this resource"))
 			return
 		}
 
-		// For now, just pass the request to the next handler
-		// TODO: Implement proper JWT validation
 		next.ServeHTTP(w, r)
 	}
 }
+
+// ClientIP returns the IP address of the client that sent the request
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
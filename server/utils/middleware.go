@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// QueryDeadline gives every request context a deadline of d, so database calls made with
+// r.Context() are cancelled when they run too long as well as when the client disconnects
+func QueryDeadline(d time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,177 @@
+// Package validate checks request bodies against declarative per-field rules and reports
+// every invalid field at once. The rules mirror the CHECK constraints and column sizes in the
+// migrations, so bad input is rejected with a helpful message before it reaches the database.
+//
+//	err := validate.Check(
+//		validate.Field("name", p.Name, validate.Required, validate.MaxLength(200)),
+//		validate.Field("price", p.Price, validate.Positive[float64]),
+//	)
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes what is wrong with one field, named as in the JSON request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error lists every invalid field of a request
+type Error struct {
+	Fields []FieldError
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + " " + f.Message
+	}
+	return "invalid request: " + strings.Join(parts, "; ")
+}
+
+// Rule checks one value and returns a message describing the problem, or "" when the value is valid
+type Rule[T any] func(value T) string
+
+// Field applies rules to the value of one field, stopping at the first rule it breaks
+func Field[T any](name string, value T, rules ...Rule[T]) []FieldError {
+	for _, rule := range rules {
+		if msg := rule(value); msg != "" {
+			return []FieldError{{Field: name, Message: msg}}
+		}
+	}
+	return nil
+}
+
+// Check collects the results of Field and returns an *Error when any field is invalid
+func Check(fields ...[]FieldError) error {
+	var errs []FieldError
+	for _, f := range fields {
+		errs = append(errs, f...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &Error{Fields: errs}
+}
+
+// String rules. Apart from Required they accept the empty string, so optional fields only
+// have to be well-formed when they are present.
+
+// Required rejects empty or whitespace-only strings
+func Required(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "is required"
+	}
+	return ""
+}
+
+// MinLength requires at least n characters
+func MinLength(n int) Rule[string] {
+	return func(s string) string {
+		if s != "" && utf8.RuneCountInString(s) < n {
+			return fmt.Sprintf("must be at least %d characters", n)
+		}
+		return ""
+	}
+}
+
+// MaxLength allows at most n characters, matching a VARCHAR(n) column
+func MaxLength(n int) Rule[string] {
+	return func(s string) string {
+		if utf8.RuneCountInString(s) > n {
+			return fmt.Sprintf("must be at most %d characters", n)
+		}
+		return ""
+	}
+}
+
+// MaxBytes allows at most n bytes, for limits such as bcrypt's 72-byte input
+func MaxBytes(n int) Rule[string] {
+	return func(s string) string {
+		if len(s) > n {
+			return fmt.Sprintf("must be at most %d bytes", n)
+		}
+		return ""
+	}
+}
+
+// emailPattern is the same expression as the users_email_check constraint
+var emailPattern = regexp.MustCompile(`^[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}$`)
+
+// Email requires a plausible email address
+func Email(s string) string {
+	if s != "" && !emailPattern.MatchString(s) {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+// phonePattern allows an optional leading +, then digits with spaces, dots, dashes or parentheses
+var phonePattern = regexp.MustCompile(`^\+?[0-9 ().-]+$`)
+
+// Phone requires a phone number of 7 to 15 digits, optionally formatted
+func Phone(s string) string {
+	if s == "" {
+		return ""
+	}
+	digits := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	if !phonePattern.MatchString(s) || digits < 7 || digits > 15 {
+		return "must be a valid phone number"
+	}
+	return ""
+}
+
+// OneOf requires the value to be one of the allowed values
+func OneOf(allowed ...string) Rule[string] {
+	return func(s string) string {
+		for _, a := range allowed {
+			if s == a {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(allowed, ", ")
+	}
+}
+
+// Number rules
+
+// Number is the set of numeric types the number rules work with
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+// Positive requires a value greater than zero
+func Positive[T Number](n T) string {
+	if n <= 0 {
+		return "must be greater than 0"
+	}
+	return ""
+}
+
+// NonNegative requires a value of zero or more
+func NonNegative[T Number](n T) string {
+	if n < 0 {
+		return "must not be negative"
+	}
+	return ""
+}
+
+// AtMost requires a value no greater than max
+func AtMost[T Number](max T) Rule[T] {
+	return func(n T) string {
+		if n > max {
+			return fmt.Sprintf("must be at most %v", max)
+		}
+		return ""
+	}
+}